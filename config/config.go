@@ -0,0 +1,278 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the application.
+// Fields are loaded from (in increasing priority) their default tag, the
+// optional config file, the .env file and the environment.
+type Config struct {
+	Env      string   `env:"APP_ENV" default:"development" yaml:"env" toml:"env"`
+	HTTP     HTTP     `yaml:"http" toml:"http"`
+	DB       DB       `yaml:"db" toml:"db"`
+	Supabase Supabase `yaml:"supabase" toml:"supabase"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	SMTP     SMTP     `yaml:"smtp" toml:"smtp"`
+	Mail     Mail     `yaml:"mail" toml:"mail"`
+	Stripe   Stripe   `yaml:"stripe" toml:"stripe"`
+	Log      Log      `yaml:"log" toml:"log"`
+	Event    Event    `yaml:"event" toml:"event"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+	Metrics  Metrics  `yaml:"metrics" toml:"metrics"`
+}
+
+// HTTP configures the web server.
+type HTTP struct {
+	Addr            string        `env:"HTTP_ADDR" default:":8000" yaml:"addr" toml:"addr"`
+	BaseURL         string        `env:"BASE_URL" default:"http://localhost:8000" yaml:"base_url" toml:"base_url"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// DB configures the Postgres connection.
+type DB struct {
+	Host     string `env:"DB_HOST" default:"localhost" yaml:"host" toml:"host"`
+	Port     int    `env:"DB_PORT" default:"5432" yaml:"port" toml:"port"`
+	User     string `env:"DB_USER" required:"true" yaml:"user" toml:"user"`
+	Password string `env:"DB_PASSWORD" secret:"true" yaml:"password" toml:"password"`
+	Name     string `env:"DB_NAME" required:"true" yaml:"name" toml:"name"`
+	SSLMode  string `env:"DB_SSLMODE" default:"disable" yaml:"sslmode" toml:"sslmode"`
+}
+
+// DSN returns the connection string for the database.
+func (d DB) DSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     fmt.Sprintf("%s:%d", d.Host, d.Port),
+		Path:     d.Name,
+		RawQuery: "sslmode=" + url.QueryEscape(d.SSLMode),
+	}
+	return u.String()
+}
+
+// Supabase configures the Supabase client and the verification of the
+// access tokens it issues.
+type Supabase struct {
+	URL string `env:"SUPABASE_URL" required:"true" yaml:"url" toml:"url"`
+	Key string `env:"SUPABASE_KEY" required:"true" secret:"true" yaml:"key" toml:"key"`
+	// ServiceRoleKey is the service_role key of the project. It is used
+	// for admin calls, like setting the password of a reset, and must
+	// never be sent to browsers.
+	ServiceRoleKey string `env:"SUPABASE_SERVICE_ROLE_KEY" required:"true" secret:"true" yaml:"service_role_key" toml:"service_role_key"`
+	// JWTSecret verifies HS256 tokens. Asymmetric tokens are verified with
+	// the keys published at JWKSURL, which defaults to the one of URL.
+	JWTSecret   string        `env:"SUPABASE_JWT_SECRET" secret:"true" yaml:"jwt_secret" toml:"jwt_secret"`
+	JWKSURL     string        `env:"SUPABASE_JWKS_URL" yaml:"jwks_url" toml:"jwks_url"`
+	JWKSRefresh time.Duration `env:"SUPABASE_JWKS_REFRESH" default:"10m" yaml:"jwks_refresh" toml:"jwks_refresh"`
+	// Audience and Issuer are the expected aud and iss claims. Issuer
+	// defaults to the auth endpoint of URL.
+	Audience string `env:"SUPABASE_JWT_AUDIENCE" default:"authenticated" yaml:"audience" toml:"audience"`
+	Issuer   string `env:"SUPABASE_JWT_ISSUER" yaml:"issuer" toml:"issuer"`
+	// RemoteFallback asks Supabase about a token when no key to verify it
+	// locally is available.
+	RemoteFallback bool `env:"SUPABASE_AUTH_REMOTE_FALLBACK" default:"false" yaml:"remote_fallback" toml:"remote_fallback"`
+}
+
+// AuthURL returns the base url of the Supabase auth API.
+func (s Supabase) AuthURL() string {
+	return strings.TrimRight(s.URL, "/") + "/auth/v1"
+}
+
+// Auth configures the tokens issued by GoTrack itself.
+type Auth struct {
+	JWTSecret string `env:"JWT_SECRET" required:"true" secret:"true" yaml:"jwt_secret" toml:"jwt_secret"`
+	// SessionKey encrypts the Supabase refresh tokens of the sessions in
+	// the database. It is 32 random bytes, base64 encoded, for example
+	// the output of "openssl rand -base64 32".
+	SessionKey                   string `env:"AUTH_SESSION_KEY" required:"true" secret:"true" yaml:"session_key" toml:"session_key"`
+	EmailVerificationExpiryHours int    `env:"AUTH_EMAIL_VERIFICATION_EXPIRY_IN_HOURS" default:"1" yaml:"email_verification_expiry_hours" toml:"email_verification_expiry_hours"`
+	// VerificationResendInterval is how long a user has to wait before
+	// another verification mail is sent.
+	VerificationResendInterval time.Duration `env:"AUTH_VERIFICATION_RESEND_INTERVAL" default:"1m" yaml:"verification_resend_interval" toml:"verification_resend_interval"`
+	// PasswordResetTTL is how long a password reset link is valid.
+	PasswordResetTTL time.Duration `env:"AUTH_PASSWORD_RESET_TTL" default:"1h" yaml:"password_reset_ttl" toml:"password_reset_ttl"`
+	// PasswordResetInterval is how long a user has to wait before another
+	// password reset link is sent.
+	PasswordResetInterval time.Duration `env:"AUTH_PASSWORD_RESET_INTERVAL" default:"1m" yaml:"password_reset_interval" toml:"password_reset_interval"`
+	// OAuthProviders is a comma separated list of the Supabase OAuth
+	// providers users can sign in with. The redirect url
+	// BASE_URL/auth/callback** has to be allowed in Supabase.
+	OAuthProviders string `env:"AUTH_OAUTH_PROVIDERS" default:"github" yaml:"oauth_providers" toml:"oauth_providers"`
+}
+
+// Providers returns the enabled OAuth providers.
+func (a Auth) Providers() []string {
+	var providers []string
+	for _, p := range strings.Split(a.OAuthProviders, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// SessionKeyBytes returns the decoded SessionKey.
+func (a Auth) SessionKeyBytes() []byte {
+	key, _ := base64.StdEncoding.DecodeString(a.SessionKey)
+	return key
+}
+
+// EmailVerificationExpiry returns the lifetime of an email verification token.
+func (a Auth) EmailVerificationExpiry() time.Duration {
+	return time.Duration(a.EmailVerificationExpiryHours) * time.Hour
+}
+
+// SMTP configures the outgoing mail server.
+type SMTP struct {
+	Sender   string `env:"SMTP_SENDER" yaml:"sender" toml:"sender"`
+	Server   string `env:"SMTP_SERVER" yaml:"server" toml:"server"`
+	Username string `env:"SMTP_USERNAME" yaml:"username" toml:"username"`
+	Password string `env:"SMTP_PASSWORD" secret:"true" yaml:"password" toml:"password"`
+	Port     int    `env:"SMTP_PORT" default:"587" yaml:"port" toml:"port"`
+}
+
+// Enabled returns true when enough is configured to send mails.
+func (s SMTP) Enabled() bool {
+	return s.Sender != "" && s.Server != ""
+}
+
+// Mail configures the mail dispatcher.
+type Mail struct {
+	Workers   int `env:"MAIL_WORKERS" default:"5" yaml:"workers" toml:"workers"`
+	QueueSize int `env:"MAIL_QUEUE_SIZE" default:"100" yaml:"queue_size" toml:"queue_size"`
+}
+
+// Stripe holds the Stripe price ids of the plans.
+type Stripe struct {
+	FreePID       string `env:"STRIPE_FREE_PID" yaml:"free_pid" toml:"free_pid"`
+	BusinessPID   string `env:"STRIPE_BUSINESS_PID" yaml:"business_pid" toml:"business_pid"`
+	EnterprisePID string `env:"STRIPE_ENTERPRISE_PID" yaml:"enterprise_pid" toml:"enterprise_pid"`
+}
+
+// Log configures the application logger.
+type Log struct {
+	File string `env:"GO_TRACK_LOG" yaml:"file" toml:"file"`
+	// Format is either "logfmt" or "json".
+	Format string `env:"LOG_FORMAT" default:"logfmt" yaml:"format" toml:"format"`
+	// Level is one of "debug", "info", "warn" or "error".
+	Level string `env:"LOG_LEVEL" default:"info" yaml:"level" toml:"level"`
+	// Redact is a comma separated list of extra keys whose values are masked.
+	Redact string `env:"LOG_REDACT" yaml:"redact" toml:"redact"`
+	// MaxSizeMB, MaxAge and MaxFiles control the rotation of File.
+	// Zero disables the limit.
+	MaxSizeMB int           `env:"LOG_MAX_SIZE_MB" default:"100" yaml:"max_size_mb" toml:"max_size_mb"`
+	MaxAge    time.Duration `env:"LOG_MAX_AGE" default:"24h" yaml:"max_age" toml:"max_age"`
+	MaxFiles  int           `env:"LOG_MAX_FILES" default:"7" yaml:"max_files" toml:"max_files"`
+	Compress  bool          `env:"LOG_COMPRESS" default:"true" yaml:"compress" toml:"compress"`
+}
+
+// RedactKeys returns the extra keys of Redact.
+func (l Log) RedactKeys() []string {
+	if l.Redact == "" {
+		return nil
+	}
+	return strings.Split(l.Redact, ",")
+}
+
+// Event configures the event bus.
+type Event struct {
+	Outbox bool `env:"EVENT_OUTBOX" default:"false" yaml:"outbox" toml:"outbox"`
+}
+
+// Tracing configures OpenTelemetry tracing.
+type Tracing struct {
+	Enabled bool `env:"TRACING_ENABLED" default:"false" yaml:"enabled" toml:"enabled"`
+	// Exporter is either "otlp" or "stdout".
+	Exporter    string  `env:"TRACING_EXPORTER" default:"otlp" yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" yaml:"endpoint" toml:"endpoint"`
+	Insecure    bool    `env:"TRACING_INSECURE" default:"false" yaml:"insecure" toml:"insecure"`
+	ServiceName string  `env:"OTEL_SERVICE_NAME" default:"gotrack" yaml:"service_name" toml:"service_name"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1" yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Metrics configures the Prometheus endpoint. The metrics cover every
+// account, so /metrics is only served on the web server when Token is set.
+// Without Addr or Token metrics aren't served, which is logged on start.
+type Metrics struct {
+	// Addr serves /metrics on a listener of its own, for example
+	// "127.0.0.1:9100", instead of the web server.
+	Addr string `env:"METRICS_ADDR" yaml:"addr" toml:"addr"`
+	// Token is the bearer token scrapers have to send.
+	Token string `env:"METRICS_TOKEN" secret:"true" yaml:"token" toml:"token"`
+}
+
+// validate checks the settings that can't be expressed with tags.
+func (c *Config) validate(errs *Errors) {
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		errs.add("DB_PORT", "must be between 1 and 65535")
+	}
+	if c.SMTP.Port < 1 || c.SMTP.Port > 65535 {
+		errs.add("SMTP_PORT", "must be between 1 and 65535")
+	}
+	if c.Supabase.URL != "" {
+		if u, err := url.Parse(c.Supabase.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs.add("SUPABASE_URL", "is not a valid url")
+		}
+	}
+	if c.Supabase.ServiceRoleKey != "" && c.Supabase.ServiceRoleKey == c.Supabase.Key {
+		errs.add("SUPABASE_SERVICE_ROLE_KEY", "must be the service_role key, not SUPABASE_KEY")
+	}
+	if c.Supabase.JWKSRefresh <= 0 {
+		errs.add("SUPABASE_JWKS_REFRESH", "must be positive")
+	}
+	if u, err := url.Parse(c.HTTP.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs.add("BASE_URL", "is not a valid url")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs.add("SHUTDOWN_TIMEOUT", "must be positive")
+	}
+	if c.Auth.SessionKey != "" && len(c.Auth.SessionKeyBytes()) != 32 {
+		errs.add("AUTH_SESSION_KEY", "must be 32 bytes, base64 encoded")
+	}
+	if c.Auth.VerificationResendInterval < 0 {
+		errs.add("AUTH_VERIFICATION_RESEND_INTERVAL", "must not be negative")
+	}
+	if c.Auth.PasswordResetTTL <= 0 {
+		errs.add("AUTH_PASSWORD_RESET_TTL", "must be positive")
+	}
+	if c.Auth.PasswordResetInterval < 0 {
+		errs.add("AUTH_PASSWORD_RESET_INTERVAL", "must not be negative")
+	}
+	if c.Auth.EmailVerificationExpiryHours <= 0 {
+		errs.add("AUTH_EMAIL_VERIFICATION_EXPIRY_IN_HOURS", "must be positive")
+	}
+	if c.Mail.Workers <= 0 {
+		errs.add("MAIL_WORKERS", "must be positive")
+	}
+	if c.Mail.QueueSize <= 0 {
+		errs.add("MAIL_QUEUE_SIZE", "must be positive")
+	}
+	if c.Log.Format != "logfmt" && c.Log.Format != "json" {
+		errs.add("LOG_FORMAT", `must be "logfmt" or "json"`)
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs.add("LOG_LEVEL", `must be "debug", "info", "warn" or "error"`)
+	}
+	if c.Log.MaxSizeMB < 0 {
+		errs.add("LOG_MAX_SIZE_MB", "must not be negative")
+	}
+	if c.Log.MaxAge < 0 {
+		errs.add("LOG_MAX_AGE", "must not be negative")
+	}
+	if c.Log.MaxFiles < 0 {
+		errs.add("LOG_MAX_FILES", "must not be negative")
+	}
+	if c.Tracing.Exporter != "otlp" && c.Tracing.Exporter != "stdout" {
+		errs.add("TRACING_EXPORTER", `must be "otlp" or "stdout"`)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs.add("TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("DB_USER", "")
+	t.Setenv("DB_NAME", "")
+	t.Setenv("SUPABASE_URL", "")
+	t.Setenv("SUPABASE_KEY", "")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("AUTH_SESSION_KEY", "dG9vIHNob3J0")
+	t.Setenv("DB_PORT", "not-a-port")
+
+	_, err := Load("")
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	for _, key := range []string{"DB_USER", "DB_NAME", "SUPABASE_URL", "SUPABASE_KEY", "SUPABASE_SERVICE_ROLE_KEY", "JWT_SECRET", "AUTH_SESSION_KEY", "DB_PORT"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("expected %s to be reported in %q", key, err)
+		}
+	}
+}
+
+func TestLoadFileAndRedact(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	path := filepath.Join(dir, "gotrack.yaml")
+	file := `
+db:
+  user: gotrack
+  name: gotrack
+  password: file-password
+supabase:
+  url: https://example.supabase.co
+  key: file-key
+  service_role_key: file-service-role-key
+auth:
+  jwt_secret: file-secret
+  session_key: c2Vzc2lvbi1rZXktb2YtdGhpcnR5LXR3by1ieXRlcyE=
+http:
+  shutdown_timeout: 5s
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_PASSWORD", "env-password")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Password != "env-password" {
+		t.Errorf("expected the environment to override the file, got %q", cfg.DB.Password)
+	}
+	if cfg.HTTP.ShutdownTimeout.Seconds() != 5 {
+		t.Errorf("expected shutdown timeout of 5s, got %s", cfg.HTTP.ShutdownTimeout)
+	}
+	if cfg.HTTP.Addr != ":8000" {
+		t.Errorf("expected default addr, got %q", cfg.HTTP.Addr)
+	}
+
+	out := cfg.String()
+	for _, secret := range []string{"env-password", "file-key", "file-service-role-key", "file-secret", "c2Vzc2lvbi1rZXktb2YtdGhpcnR5LXR3by1ieXRlcyE="} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q leaked in %q", secret, out)
+		}
+	}
+}
+
+// chdir moves into dir so no .env of the repository is picked up.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Errors collects every missing or invalid setting found while loading.
+type Errors []string
+
+func (e *Errors) add(key, msg string) {
+	*e = append(*e, key+" "+msg)
+}
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+var current *Config
+
+// Init loads the configuration and makes it available through Get.
+func Init(path string) (*Config, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	current = cfg
+	return cfg, nil
+}
+
+// Get returns the configuration loaded by Init.
+func Get() *Config {
+	if current == nil {
+		panic("config: Get called before Init")
+	}
+	return current
+}
+
+// Load reads the configuration from the defaults, the optional file at path
+// (.yaml, .yml or .toml), the .env file and the environment. It reports all
+// missing or invalid settings at once as Errors.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	var errs Errors
+
+	// Defaults go in first so the file and the environment can override them.
+	walk(reflect.ValueOf(cfg).Elem(), func(f reflect.Value, sf reflect.StructField) {
+		if def, ok := sf.Tag.Lookup("default"); ok {
+			if err := set(f, def); err != nil {
+				errs.add(sf.Tag.Get("env"), "has an invalid default")
+			}
+		}
+	})
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// godotenv never overrides variables that are already set.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("config: load .env: %w", err)
+	}
+
+	walk(reflect.ValueOf(cfg).Elem(), func(f reflect.Value, sf reflect.StructField) {
+		key := sf.Tag.Get("env")
+		if key == "" {
+			return
+		}
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			if err := set(f, v); err != nil {
+				// Never echo the value, it might be a secret.
+				errs.add(key, fmt.Sprintf("must be a valid %s", kind(f)))
+				return
+			}
+		}
+		if sf.Tag.Get("required") == "true" && f.IsZero() {
+			errs.add(key, "is required")
+		}
+	})
+
+	cfg.validate(&errs)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, cfg)
+	case ".toml":
+		err = toml.Unmarshal(b, cfg)
+	default:
+		return fmt.Errorf("config: unsupported file type %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// String returns the configuration as KEY=value lines with secrets masked.
+func (c *Config) String() string {
+	var b strings.Builder
+	walk(reflect.ValueOf(c).Elem(), func(f reflect.Value, sf reflect.StructField) {
+		key := sf.Tag.Get("env")
+		if key == "" {
+			return
+		}
+		val := fmt.Sprint(f.Interface())
+		if sf.Tag.Get("secret") == "true" {
+			val = redact(val)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, val)
+	})
+	return b.String()
+}
+
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "******"
+}
+
+// walk calls fn for every leaf field of the struct v.
+func walk(v reflect.Value, fn func(reflect.Value, reflect.StructField)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, sf := v.Field(i), t.Field(i)
+		if f.Kind() == reflect.Struct {
+			walk(f, fn)
+			continue
+		}
+		fn(f, sf)
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func set(f reflect.Value, s string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported kind %s", f.Kind())
+	}
+	return nil
+}
+
+func kind(f reflect.Value) string {
+	if f.Type() == durationType {
+		return "duration"
+	}
+	switch f.Kind() {
+	case reflect.Int:
+		return "integer"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float64:
+		return "number"
+	default:
+		return f.Kind().String()
+	}
+}
@@ -2,11 +2,15 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strconv"
 
-	"github.com/NikoMalik/GoTrack/db"
+	"github.com/NikoMalik/GoTrack/event"
+	"github.com/NikoMalik/GoTrack/filter"
 	"github.com/NikoMalik/GoTrack/logEvent"
 
-	"github.com/gofiber/fiber/v2"
 	"github.com/nedpals/supabase-go"
 	"github.com/uptrace/bun"
 )
@@ -32,8 +36,11 @@ const (
 	PlanEnterprise
 )
 
+// Account is an organization. Its members share its hosts, plan and
+// notification settings.
 type Account struct {
 	ID                   int64 `bun:",pk,autoincrement"`
+	Name                 string
 	UserID               string
 	StripeCustomerID     string
 	StripeSubscriptionID string
@@ -42,56 +49,147 @@ type Account struct {
 	NotifyUpfront        int
 	NotifyDefaultEmail   string
 	NotifyWebhookURL     string
+	// Require2FA makes two-factor authentication mandatory for the
+	// members.
+	Require2FA bool `bun:"require_2fa"`
 }
 
-func GetUserAccount(userID string) (*Account, error) {
+type accountRepo struct {
+	db bun.IDB
+}
+
+func (r accountRepo) Get(ctx context.Context, id int64) (*Account, error) {
 	account := new(Account)
-	ctx := context.Background()
-	err := db.Bun.NewSelect().Model(account).Where("user_id = ?", userID).Scan(ctx)
+	err := r.db.NewSelect().Model(account).Where("id = ?", id).Scan(ctx)
 	return account, err
 }
 
-func GetAccount(query fiber.Map) (*Account, error) {
+func (r accountRepo) GetByUserID(ctx context.Context, userID string) (*Account, error) {
 	account := new(Account)
-	builder := db.Bun.NewSelect().Model(account)
-	for k, v := range query {
-		builder.Where("? = ?", bun.Ident(k), v)
-	}
-	err := builder.Scan(context.Background())
+	err := r.db.NewSelect().Model(account).Where("user_id = ?", userID).Order("id").Limit(1).Scan(ctx)
 	return account, err
 }
 
-func GetAccounts(c *fiber.Ctx) ([]*Account, error) {
-	var accounts []*Account
+func (r accountRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[*Account], error) {
+	return filter.List[*Account](ctx, r.db, AccountSchema, spec)
+}
+
+// Update saves acc and records the changes in the audit log. Plan and
+// notification changes are audited under their own actions.
+func (r accountRepo) Update(ctx context.Context, acc *Account) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before := new(Account)
+		if err := tx.NewSelect().Model(before).Where("id = ?", acc.ID).For("UPDATE").Scan(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewUpdate().Model(acc).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		for _, rec := range AccountAuditRecords(before, acc) {
+			if err := insertAudit(ctx, tx, rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	err := db.Bun.NewSelect().Model(&accounts).Scan(context.Background())
+func (r accountRepo) Create(ctx context.Context, user *supabase.User) (*Account, error) {
+	acc := NewAccount(user)
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return createAccount(ctx, tx, user, acc)
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return accounts, nil
+	logEvent.FromContext(ctx).Info("new account signup", "id", acc.ID)
+	return acc, nil
 }
 
-func UpdateAccount(acc *Account) error {
-	_, err := db.Bun.NewUpdate().Model(acc).WherePK().Exec(context.Background())
-	return err
+func (r accountRepo) FirstOrCreate(ctx context.Context, user *supabase.User) (*Account, error) {
+	acc := new(Account)
+	var created bool
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Serializes the requests of the user until the account is
+		// committed.
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", "account:"+user.ID); err != nil {
+			return err
+		}
+		err := tx.NewSelect().Model(acc).
+			Where("id = (SELECT account_id FROM memberships WHERE user_id = ? ORDER BY created_at, account_id LIMIT 1)", user.ID).
+			Scan(ctx)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		acc, created = NewAccount(user), true
+		return createAccount(ctx, tx, user, acc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		logEvent.FromContext(ctx).Info("new account signup", "id", acc.ID)
+	}
+	return acc, nil
 }
 
-func CreateAccount(user *supabase.User) (*Account, error) {
-	if acc, err := GetUserAccount(user.ID); err == nil {
-		return acc, nil
+// createAccount inserts acc with user as its owner.
+func createAccount(ctx context.Context, tx bun.Tx, user *supabase.User, acc *Account) error {
+	if _, err := tx.NewInsert().Model(acc).Exec(ctx); err != nil {
+		return err
 	}
+	owner := &Membership{AccountID: acc.ID, UserID: user.ID, Email: user.Email, AccessLevel: RoleOwner}
+	if _, err := tx.NewInsert().Model(owner).Exec(ctx); err != nil {
+		return err
+	}
+	return event.EmitTx(ctx, tx, AccountCreatedEvent, acc)
+}
 
-	acc := Account{
+// NewAccount returns the defaults of a new account of user.
+func NewAccount(user *supabase.User) *Account {
+	return &Account{
+		Name:               user.Email,
 		UserID:             user.ID,
 		NotifyUpfront:      7,
 		NotifyDefaultEmail: user.Email,
 		Plan:               PlanStarter,
 	}
-	_, err := db.Bun.NewInsert().Model(&acc).Exec(context.Background())
-	if err != nil {
-		return nil, err
+}
+
+// AccountAuditRecords returns the audit records of an account update.
+func AccountAuditRecords(before, after *Account) []AuditRecord {
+	var recs []AuditRecord
+	for _, action := range []string{AuditAccountUpdate, AuditPlanChange, AuditNotificationUpdate} {
+		fields := accountAuditFields[action]
+		b, a := pick(before, fields), pick(after, fields)
+		if Diff(b, a) == nil {
+			continue
+		}
+		recs = append(recs, AuditRecord{
+			Action:     action,
+			AccountID:  &after.ID,
+			TargetType: "account",
+			TargetID:   strconv.FormatInt(after.ID, 10),
+			Before:     b,
+			After:      a,
+		})
+	}
+	return recs
+}
+
+// accountAuditFields splits the fields of Account into audit actions.
+var accountAuditFields = map[string][]string{
+	AuditPlanChange:         {"Plan", "StripeSubscriptionID", "SubscriptionStatus"},
+	AuditNotificationUpdate: {"NotifyUpfront", "NotifyDefaultEmail", "NotifyWebhookURL"},
+	AuditAccountUpdate:      {"Name", "UserID", "StripeCustomerID", "Require2FA"},
+}
+
+// pick returns a copy of acc with only fields set.
+func pick(acc *Account, fields []string) *Account {
+	out := new(Account)
+	src, dst := reflect.ValueOf(acc).Elem(), reflect.ValueOf(out).Elem()
+	for _, f := range fields {
+		dst.FieldByName(f).Set(src.FieldByName(f))
 	}
-	logEvent.Log("event", "new account signup", "id", acc.ID)
-	return &acc, nil
+	return out
 }
@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	// APIKeyPrefix starts every API key, so leaked keys are easy to spot.
+	APIKeyPrefix = "gt_"
+	// apiKeyVisible is how many characters of a key are kept to tell it
+	// apart in the settings.
+	apiKeyVisible = len(APIKeyPrefix) + 8
+)
+
+// ScopeRead grants every read permission.
+const ScopeRead = "read"
+
+// APIKeyScopes are the scopes a key can be given. The API reads and
+// manages hosts only, so there are no other write scopes. Managing the
+// account, and so its keys, is left to signed in users.
+var APIKeyScopes = []string{
+	ScopeRead,
+	string(PermHostsRead), string(PermHostsWrite),
+	string(PermMembersRead),
+	string(PermBillingRead),
+	string(PermAuditRead),
+}
+
+// APIKey gives scripts access to an account. A personal key acts as the
+// user who created it and never grants more than their role, an
+// organization key acts on its own. Only the hash of the key is stored.
+type APIKey struct {
+	ID        int64 `bun:",pk,autoincrement"`
+	AccountID int64
+	// UserID is the owner of a personal key, empty for organization keys.
+	UserID string `bun:",nullzero"`
+	Name   string
+	// Prefix is the start of the key, shown to tell keys apart.
+	Prefix     string
+	Hash       string   `json:"-"`
+	Scopes     []string `bun:",array"`
+	CreatedBy  string
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string    `bun:"last_used_ip"`
+	CreatedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// NewAPIKey returns a key of an account and the secret that authenticates
+// with it.
+func NewAPIKey(accountID int64, name string, scopes []string) (*APIKey, string) {
+	secret := APIKeyPrefix + newToken()
+	return &APIKey{
+		AccountID: accountID,
+		Name:      name,
+		Prefix:    secret[:apiKeyVisible],
+		Hash:      APIKeyHash(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}, secret
+}
+
+// APIKeyHash returns the hash of secret that is stored in its place.
+func APIKeyHash(secret string) string {
+	return hashToken(secret)
+}
+
+// Personal reports whether the key acts as a user.
+func (k *APIKey) Personal() bool {
+	return k.UserID != ""
+}
+
+// Valid reports whether the key may be used at now.
+func (k *APIKey) Valid(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the scopes of the key include p.
+func (k *APIKey) Allows(p Permission) bool {
+	if slices.Contains(k.Scopes, string(p)) {
+		return true
+	}
+	return slices.Contains(k.Scopes, ScopeRead) && strings.HasSuffix(string(p), ":read")
+}
+
+// APIKeyAuditRecord describes a change to an API key.
+func APIKeyAuditRecord(action string, k *APIKey) AuditRecord {
+	return AuditRecord{
+		Action:     action,
+		AccountID:  &k.AccountID,
+		TargetType: "api_key",
+		TargetID:   k.Prefix,
+		After:      apiKeyAudit{Name: k.Name, UserID: k.UserID, Scopes: k.Scopes, ExpiresAt: k.ExpiresAt},
+	}
+}
+
+// apiKeyAudit holds the audited fields of an API key.
+type apiKeyAudit struct {
+	Name      string
+	UserID    string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type apiKeyRepo struct {
+	db bun.IDB
+}
+
+func (r apiKeyRepo) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	k := new(APIKey)
+	err := r.db.NewSelect().Model(k).
+		Where("hash = ?", hash).
+		Where("revoked_at IS NULL").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Scan(ctx)
+	return k, err
+}
+
+func (r apiKeyRepo) List(ctx context.Context, accountID int64) ([]APIKey, error) {
+	var keys []APIKey
+	err := r.db.NewSelect().Model(&keys).
+		Where("account_id = ?", accountID).
+		Where("revoked_at IS NULL").
+		Order("created_at DESC").
+		Scan(ctx)
+	return keys, err
+}
+
+func (r apiKeyRepo) Create(ctx context.Context, k *APIKey) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(k).Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, APIKeyAuditRecord(AuditAPIKeyCreate, k))
+	})
+}
+
+func (r apiKeyRepo) Revoke(ctx context.Context, accountID, id int64) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		k := new(APIKey)
+		err := tx.NewUpdate().Model(k).
+			Set("revoked_at = ?", time.Now()).
+			Where("id = ?", id).
+			Where("account_id = ?", accountID).
+			Where("revoked_at IS NULL").
+			Returning("*").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, APIKeyAuditRecord(AuditAPIKeyRevoke, k))
+	})
+}
+
+func (r apiKeyRepo) Touch(ctx context.Context, id int64, ip string, at time.Time) error {
+	res, err := r.db.NewUpdate().Model((*APIKey)(nil)).
+		Set("last_used_at = ?", at).
+		Set("last_used_ip = ?", ip).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
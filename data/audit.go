@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/uptrace/bun"
+)
+
+// Audit actions.
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login.failed"
+	AuditLogout             = "auth.logout"
+	AuditPermissionDenied   = "auth.permission.denied"
+	AuditSignup             = "auth.signup"
+	AuditEmailVerify        = "auth.email.verify"
+	AuditPasswordReset      = "auth.password.reset"
+	AuditPasswordChange     = "auth.password.change"
+	AuditTwoFactorEnable    = "auth.2fa.enable"
+	AuditTwoFactorDisable   = "auth.2fa.disable"
+	AuditTwoFactorFailed    = "auth.2fa.failed"
+	AuditRecoveryCodeUse    = "auth.2fa.recovery"
+	AuditIdentityLink       = "auth.identity.link"
+	AuditSessionRevoke      = "auth.session.revoke"
+	AuditSessionRevokeAll   = "auth.session.revoke_all"
+	AuditAPIKeyCreate       = "auth.api_key.create"
+	AuditAPIKeyRevoke       = "auth.api_key.revoke"
+	AuditAccountUpdate      = "account.update"
+	AuditPlanChange         = "account.plan.change"
+	AuditNotificationUpdate = "account.notification.update"
+	AuditMemberInvite       = "account.member.invite"
+	AuditMemberJoin         = "account.member.join"
+	AuditMemberRemove       = "account.member.remove"
+	AuditMemberRoleChange   = "account.member.role"
+	AuditInvitationRevoke   = "account.invitation.revoke"
+	AuditHostCreate         = "host.create"
+	AuditHostUpdate         = "host.update"
+	AuditHostDelete         = "host.delete"
+	AuditServiceCreate      = "service.create"
+	AuditServiceUpdate      = "service.update"
+	AuditServiceDelete      = "service.delete"
+)
+
+// AuditEntry is a single row of the append-only audit log.
+type AuditEntry struct {
+	bun.BaseModel `bun:"table:audit_log"`
+
+	ID         int64             `bun:",pk,autoincrement" json:"id"`
+	AccountID  *int64            `json:"account_id,omitempty"`
+	ActorID    string            `json:"actor_id"`
+	ActorEmail string            `json:"actor_email"`
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	IP         string            `bun:"ip" json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	Diff       map[string]Change `bun:",type:jsonb" json:"diff,omitempty"`
+	CreatedAt  time.Time         `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Change is the old and new value of a single field.
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Actor is who performed an action and from where.
+type Actor struct {
+	UserID    string
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFrom returns the actor stored in ctx.
+func ActorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
+
+// AuditRecord describes an action to be audited. Before and After are the
+// states of the target; either may be nil for creates and deletes.
+type AuditRecord struct {
+	Action     string
+	AccountID  *int64
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+}
+
+// insertAudit appends rec to the audit log, attributed to the actor of ctx.
+// Pass the transaction that changes the target so both are committed
+// together.
+func insertAudit(ctx context.Context, idb bun.IDB, rec AuditRecord) error {
+	_, err := idb.NewInsert().Model(NewAuditEntry(ActorFrom(ctx), rec)).Exec(ctx)
+	return err
+}
+
+// NewAuditEntry returns the entry of rec performed by actor.
+func NewAuditEntry(actor Actor, rec AuditRecord) *AuditEntry {
+	return &AuditEntry{
+		AccountID:  rec.AccountID,
+		ActorID:    actor.UserID,
+		ActorEmail: actor.Email,
+		Action:     rec.Action,
+		TargetType: rec.TargetType,
+		TargetID:   rec.TargetID,
+		IP:         actor.IP,
+		UserAgent:  actor.UserAgent,
+		Diff:       Diff(rec.Before, rec.After),
+	}
+}
+
+// Diff returns the exported fields that differ between before and after,
+// which must be structs (or pointers to structs) of the same type or nil.
+// Values of sensitive fields are never included.
+func Diff(before, after any) map[string]Change {
+	b, a := structValue(before), structValue(after)
+	if !b.IsValid() && !a.IsValid() {
+		return nil
+	}
+	var t reflect.Type
+	if a.IsValid() {
+		t = a.Type()
+	} else {
+		t = b.Type()
+	}
+
+	diff := make(map[string]Change)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Anonymous || sf.Name == "UpdatedAt" {
+			continue
+		}
+		// Relations are audited on their own.
+		if tag := sf.Tag.Get("bun"); strings.HasPrefix(tag, "rel:") || strings.Contains(tag, "scanonly") {
+			continue
+		}
+		var old, cur any
+		if b.IsValid() {
+			old = b.Field(i).Interface()
+		}
+		if a.IsValid() {
+			cur = a.Field(i).Interface()
+		}
+		if reflect.DeepEqual(old, cur) {
+			continue
+		}
+		if sensitiveField(sf.Name) {
+			old, cur = "[REDACTED]", "[REDACTED]"
+		}
+		diff[sf.Name] = Change{Old: old, New: cur}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func structValue(v any) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return rv
+}
+
+func sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"password", "token", "secret", "key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditScope restricts the audit log to the entries of an account. Entries
+// the user performed outside of the account, like logins, are included. A
+// zero scope includes every entry.
+type AuditScope struct {
+	AccountID int64
+	UserID    string
+}
+
+// Match reports whether e is in scope.
+func (sc AuditScope) Match(e *AuditEntry) bool {
+	if sc.AccountID == 0 && sc.UserID == "" {
+		return true
+	}
+	return (sc.AccountID != 0 && e.AccountID != nil && *e.AccountID == sc.AccountID) ||
+		(sc.UserID != "" && e.ActorID == sc.UserID)
+}
+
+type auditRepo struct {
+	db bun.IDB
+}
+
+func (r auditRepo) Record(ctx context.Context, rec AuditRecord) error {
+	return insertAudit(ctx, r.db, rec)
+}
+
+func (r auditRepo) List(ctx context.Context, scope AuditScope, spec filter.Spec) (filter.Page[AuditEntry], error) {
+	return filter.List[AuditEntry](ctx, r.db, AuditSchema, spec, func(q *bun.SelectQuery) *bun.SelectQuery {
+		if scope.AccountID == 0 && scope.UserID == "" {
+			return q
+		}
+		return q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			if scope.AccountID != 0 {
+				q = q.WhereOr("audit_entry.account_id = ?", scope.AccountID)
+			}
+			if scope.UserID != "" {
+				q = q.WhereOr("audit_entry.actor_id = ?", scope.UserID)
+			}
+			return q
+		})
+	})
+}
@@ -0,0 +1,37 @@
+package data
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	before := &Account{ID: 1, Plan: PlanStarter, NotifyUpfront: 7, StripeCustomerID: "cus_1"}
+	after := &Account{ID: 1, Plan: PlanBusiness, NotifyUpfront: 7, StripeCustomerID: "cus_1"}
+
+	diff := Diff(before, after)
+	if len(diff) != 1 {
+		t.Fatalf("got %d changes, want 1: %v", len(diff), diff)
+	}
+	if c := diff["Plan"]; c.Old != PlanStarter || c.New != PlanBusiness {
+		t.Errorf("Plan change = %+v", c)
+	}
+
+	if diff := Diff(before, before); diff != nil {
+		t.Errorf("Diff of equal values = %v, want nil", diff)
+	}
+
+	created := Diff(nil, &Host{HostName: "example.com"})
+	if c, ok := created["HostName"]; !ok || c.Old != nil || c.New != "example.com" {
+		t.Errorf("HostName change = %+v", c)
+	}
+	if _, ok := created["HostServices"]; ok {
+		t.Error("relations must not be part of the diff")
+	}
+	if deleted := Diff(&Host{HostName: "example.com"}, nil); deleted["HostName"].Old != "example.com" {
+		t.Errorf("deleted HostName change = %+v", deleted["HostName"])
+	}
+
+	type creds struct{ Email, Password string }
+	secret := Diff(&creds{"a", "old"}, &creds{"a", "new"})
+	if c := secret["Password"]; c.Old == "old" || c.New == "new" {
+		t.Errorf("password leaked into diff: %+v", c)
+	}
+}
@@ -0,0 +1,311 @@
+package data
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/uptrace/bun"
+)
+
+// MonitoredService is an active host service together with the host and
+// service type it belongs to.
+type MonitoredService struct {
+	HostServiceID  int
+	AccountID      int64
+	HostID         int
+	HostName       string
+	ServiceName    string
+	URL            string
+	ScheduleNumber int
+	ScheduleUnit   string
+}
+
+// Interval returns how often the service has to be checked.
+func (m MonitoredService) Interval() time.Duration {
+	n := time.Duration(max(m.ScheduleNumber, 1))
+	switch strings.ToLower(m.ScheduleUnit) {
+	case "s", "second", "seconds":
+		return n * time.Second
+	case "h", "hour", "hours":
+		return n * time.Hour
+	case "d", "day", "days":
+		return n * 24 * time.Hour
+	default:
+		return n * time.Minute
+	}
+}
+
+type hostRepo struct {
+	db bun.IDB
+}
+
+func (r hostRepo) Get(ctx context.Context, id int) (*Host, error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h := new(Host)
+	err = r.db.NewSelect().Model(h).Where("id = ? AND account_id = ?", id, accountID).Scan(ctx)
+	return h, err
+}
+
+func (r hostRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[Host], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[Host]{}, err
+	}
+	return filter.List[Host](ctx, r.db, HostSchema, spec, func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("host.account_id = ?", accountID)
+	})
+}
+
+func (r hostRepo) Create(ctx context.Context, h *Host) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	h.AccountID = accountID
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(h).Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostAuditRecord(AuditHostCreate, accountID, h.ID, nil, h))
+	})
+}
+
+func (r hostRepo) Update(ctx context.Context, h *Host) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before, err := lockHost(ctx, tx, accountID, h.ID)
+		if err != nil {
+			return err
+		}
+		h.AccountID = accountID
+		h.UpdatedAt = time.Now()
+		if _, err := tx.NewUpdate().Model(h).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostAuditRecord(AuditHostUpdate, accountID, h.ID, before, h))
+	})
+}
+
+func (r hostRepo) Delete(ctx context.Context, id int) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before, err := lockHost(ctx, tx, accountID, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model(before).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostAuditRecord(AuditHostDelete, accountID, id, before, nil))
+	})
+}
+
+// lockHost selects the host id of the account for update.
+func lockHost(ctx context.Context, tx bun.Tx, accountID int64, id int) (*Host, error) {
+	h := new(Host)
+	err := tx.NewSelect().Model(h).Where("id = ? AND account_id = ?", id, accountID).For("UPDATE").Scan(ctx)
+	return h, err
+}
+
+type hostServiceRepo struct {
+	db bun.IDB
+}
+
+// ofAccount restricts q on host services to the hosts of an account.
+func ofAccount(accountID int64) func(*bun.SelectQuery) *bun.SelectQuery {
+	return func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("host_service.host_id IN (SELECT id FROM hosts WHERE account_id = ?)", accountID)
+	}
+}
+
+func (r hostServiceRepo) Get(ctx context.Context, id int) (*HostService, error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hs := new(HostService)
+	err = r.db.NewSelect().Model(hs).Relation("Service").
+		Where("host_service.id = ?", id).
+		Apply(ofAccount(accountID)).
+		Scan(ctx)
+	return hs, err
+}
+
+func (r hostServiceRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[HostService], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[HostService]{}, err
+	}
+	return filter.List[HostService](ctx, r.db, HostServiceSchema, spec, func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.ColumnExpr("host_service.*").
+			ColumnExpr("h.host_name").
+			Join("JOIN hosts AS h ON h.id = host_service.host_id").
+			Where("h.account_id = ?", accountID).
+			Relation("Service")
+	})
+}
+
+func (r hostServiceRepo) ListMonitored(ctx context.Context) ([]MonitoredService, error) {
+	var services []MonitoredService
+	err := r.db.NewRaw(`
+		SELECT hs.id AS host_service_id, h.account_id, hs.host_id, h.host_name, s.service_name,
+			COALESCE(h.url, 'https://' || h.host_name) AS url,
+			hs.schedule_number, hs.schedule_unit
+		FROM host_services AS hs
+		JOIN hosts AS h ON h.id = hs.host_id
+		JOIN services AS s ON s.id = hs.service_id
+		WHERE hs.active = 1 AND h.active = 1`).Scan(ctx, &services)
+	return services, err
+}
+
+func (r hostServiceRepo) RecordCheck(ctx context.Context, s MonitoredService, status, message string, at time.Time) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		hs := new(HostService)
+		err := tx.NewSelect().Model(hs).
+			Column("id", "status").
+			Where("id = ?", s.HostServiceID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		previous := hs.Status
+		hs.Status, hs.LastCheck, hs.LastMessage = status, at, message
+		if _, err := tx.NewUpdate().Model(hs).Column("status", "last_check", "last_message").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if previous == status {
+			return nil
+		}
+		_, err = tx.NewInsert().Model(CheckEvent(s, status, message, at)).Exec(ctx)
+		return err
+	})
+}
+
+func (r hostServiceRepo) Create(ctx context.Context, hs *HostService) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// The host has to belong to the account too.
+		if _, err := lockHost(ctx, tx, accountID, hs.HostID); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(hs).Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostServiceAuditRecord(AuditServiceCreate, accountID, hs.ID, nil, hs))
+	})
+}
+
+func (r hostServiceRepo) Update(ctx context.Context, hs *HostService) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before, err := lockHostService(ctx, tx, accountID, hs.ID)
+		if err != nil {
+			return err
+		}
+		// Moving a service to another host keeps it in the account.
+		if hs.HostID != before.HostID {
+			if _, err := lockHost(ctx, tx, accountID, hs.HostID); err != nil {
+				return err
+			}
+		}
+		hs.UpdatedAt = time.Now()
+		if _, err := tx.NewUpdate().Model(hs).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostServiceAuditRecord(AuditServiceUpdate, accountID, hs.ID, before, hs))
+	})
+}
+
+func (r hostServiceRepo) Delete(ctx context.Context, id int) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		before, err := lockHostService(ctx, tx, accountID, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model(before).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, HostServiceAuditRecord(AuditServiceDelete, accountID, id, before, nil))
+	})
+}
+
+// CheckEvent returns the event recorded when a check changes the status of
+// a monitored service.
+func CheckEvent(s MonitoredService, status, message string, at time.Time) *Event {
+	return &Event{
+		EventType:     status,
+		HostServiceID: s.HostServiceID,
+		HostID:        s.HostID,
+		ServiceName:   s.ServiceName,
+		HostName:      s.HostName,
+		Message:       message,
+		CreatedAt:     at,
+		UpdatedAt:     at,
+	}
+}
+
+// lockHostService selects the host service id of the account for update.
+func lockHostService(ctx context.Context, tx bun.Tx, accountID int64, id int) (*HostService, error) {
+	hs := new(HostService)
+	err := tx.NewSelect().Model(hs).
+		Where("host_service.id = ?", id).
+		Apply(ofAccount(accountID)).
+		For("UPDATE").
+		Scan(ctx)
+	return hs, err
+}
+
+// HostAuditRecord returns the audit record of a host change.
+func HostAuditRecord(action string, accountID int64, id int, before, after *Host) AuditRecord {
+	return AuditRecord{
+		Action:     action,
+		AccountID:  &accountID,
+		TargetType: "host",
+		TargetID:   strconv.Itoa(id),
+		Before:     nilIfEmpty(before),
+		After:      nilIfEmpty(after),
+	}
+}
+
+// HostServiceAuditRecord returns the audit record of a host service change.
+func HostServiceAuditRecord(action string, accountID int64, id int, before, after *HostService) AuditRecord {
+	return AuditRecord{
+		Action:     action,
+		AccountID:  &accountID,
+		TargetType: "host_service",
+		TargetID:   strconv.Itoa(id),
+		Before:     nilIfEmpty(before),
+		After:      nilIfEmpty(after),
+	}
+}
+
+// nilIfEmpty turns a typed nil pointer into an untyped nil.
+func nilIfEmpty[T any](v *T) any {
+	if v == nil {
+		return nil
+	}
+	return v
+}
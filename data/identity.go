@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Identity links the account of a user at an OAuth provider to the user.
+type Identity struct {
+	Provider string `bun:",pk"`
+	// Subject is the id of the user at the provider.
+	Subject   string `bun:",pk"`
+	UserID    string
+	Email     string
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// IdentityAuditRecord describes the linking of an identity to a user.
+func IdentityAuditRecord(action string, id *Identity) AuditRecord {
+	return AuditRecord{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   id.UserID,
+		After:      identityAudit{Provider: id.Provider, Email: id.Email},
+	}
+}
+
+// identityAudit holds the audited fields of an identity.
+type identityAudit struct {
+	Provider string
+	Email    string
+}
+
+type identityRepo struct {
+	db bun.IDB
+}
+
+func (r identityRepo) Get(ctx context.Context, provider, subject string) (*Identity, error) {
+	id := new(Identity)
+	err := r.db.NewSelect().Model(id).
+		Where("provider = ?", provider).
+		Where("subject = ?", subject).
+		Scan(ctx)
+	return id, err
+}
+
+func (r identityRepo) Link(ctx context.Context, id *Identity) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(id).Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, IdentityAuditRecord(AuditIdentityLink, id))
+	})
+}
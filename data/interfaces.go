@@ -1,4 +1,231 @@
 package data
 
+import (
+	"context"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/nedpals/supabase-go"
+)
+
 type WsClient interface {
 }
+
+// Repos bundles the repositories the application works with. Handlers get
+// it injected, so they can run against Postgres or the in-memory
+// implementation in data/memory.
+//
+// Lookups of missing records return sql.ErrNoRows in every implementation.
+type Repos struct {
+	Accounts     AccountRepo
+	Members      MemberRepo
+	Users        UserRepo
+	Sessions     SessionRepo
+	Resets       PasswordResetRepo
+	TwoFactor    TwoFactorRepo
+	Identities   IdentityRepo
+	APIKeys      APIKeyRepo
+	Hosts        HostRepo
+	HostServices HostServiceRepo
+	Events       EventRepo
+	Audit        AuditRepo
+	Publisher    Publisher
+	Tx           Transactor
+}
+
+// Transactor runs work in a transaction.
+type Transactor interface {
+	// InTx calls fn with repositories that share one transaction, so the
+	// changes fn makes, published events included, commit or roll back
+	// together.
+	InTx(ctx context.Context, fn func(ctx context.Context, r *Repos) error) error
+}
+
+// AccountRepo stores accounts.
+type AccountRepo interface {
+	Get(ctx context.Context, id int64) (*Account, error)
+	// GetByUserID returns the oldest account created by userID.
+	GetByUserID(ctx context.Context, userID string) (*Account, error)
+	List(ctx context.Context, spec filter.Spec) (filter.Page[*Account], error)
+	// Create creates an account owned by user.
+	Create(ctx context.Context, user *supabase.User) (*Account, error)
+	// FirstOrCreate returns the oldest account user is a member of, and
+	// creates one owned by user when there is none. Concurrent calls for
+	// the same user create a single account.
+	FirstOrCreate(ctx context.Context, user *supabase.User) (*Account, error)
+	// Update saves acc and audits the changes.
+	Update(ctx context.Context, acc *Account) error
+}
+
+// MemberRepo stores the members of accounts and the invitations to join
+// them. Every change is audited.
+type MemberRepo interface {
+	// Memberships returns the accounts userID is a member of, oldest
+	// first, with Account set.
+	Memberships(ctx context.Context, userID string) ([]Membership, error)
+	// List returns the members of an account.
+	List(ctx context.Context, accountID int64) ([]Membership, error)
+	// Remove removes userID from the account. The last owner can't be
+	// removed, it returns ErrLastOwner.
+	Remove(ctx context.Context, accountID int64, userID string) error
+	// SetRole changes the role of a member. The last owner can't be
+	// demoted, it returns ErrLastOwner.
+	SetRole(ctx context.Context, accountID int64, userID string, role Role) error
+	// Invite creates an invitation, replacing a pending one to the same
+	// email address. It sets ExpiresAt.
+	Invite(ctx context.Context, inv *Invitation) error
+	// Invitations returns the pending invitations of an account.
+	Invitations(ctx context.Context, accountID int64) ([]Invitation, error)
+	// InvitationsFor returns the pending invitations addressed to email,
+	// with Account set.
+	InvitationsFor(ctx context.Context, email string) ([]Invitation, error)
+	// Accept makes the user a member of the account of a pending
+	// invitation addressed to email. It returns ErrInvitation otherwise.
+	Accept(ctx context.Context, id int64, userID, email string) (*Membership, error)
+	// Revoke deletes a pending invitation of an account.
+	Revoke(ctx context.Context, accountID, id int64) error
+}
+
+// UserRepo stores local users.
+type UserRepo interface {
+	Get(ctx context.Context, id string) (*User, error)
+	// GetByEmail returns the user with the email address, ignoring case.
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// Create stores u unless a user with its id exists.
+	Create(ctx context.Context, u *User) error
+	// MarkVerificationSent records that a verification mail is sent to
+	// the user now, unless one was sent within interval. It reports
+	// whether the mail may be sent.
+	MarkVerificationSent(ctx context.Context, id string, interval time.Duration) (bool, error)
+	// VerifyEmail marks email as verified if it is still the address of
+	// the user, and audits it. Verifying twice is not an error.
+	VerifyEmail(ctx context.Context, id, email string) error
+}
+
+// SessionRepo stores the sessions of signed in users. Sessions idle for
+// longer than SessionIdleTimeout are treated as missing.
+type SessionRepo interface {
+	Get(ctx context.Context, id string) (*Session, error)
+	// List returns the sessions of userID that aren't pending, most
+	// recently seen first.
+	List(ctx context.Context, userID string) ([]Session, error)
+	Create(ctx context.Context, s *Session) error
+	// Update saves the refresh token, whether s is pending and where and
+	// when it was last seen.
+	Update(ctx context.Context, s *Session) error
+	// Fail counts a wrong second factor entered for the pending session
+	// id and returns how many were entered so far.
+	Fail(ctx context.Context, id string) (int, error)
+	// Revoke deletes a session of userID and audits it.
+	Revoke(ctx context.Context, userID, id string) error
+	// RevokeAll deletes every session of userID but except, which may be
+	// empty, and audits it.
+	RevokeAll(ctx context.Context, userID, except string) error
+}
+
+// PasswordResetRepo stores pending password resets. Expired and used
+// resets are treated as missing.
+type PasswordResetRepo interface {
+	Get(ctx context.Context, id string) (*PasswordReset, error)
+	// Create stores reset, replacing the pending resets of the user,
+	// unless a reset of the user was created within interval. It reports
+	// whether reset is stored and may be mailed.
+	Create(ctx context.Context, reset *PasswordReset, interval time.Duration) (bool, error)
+	// Use marks a pending reset as used and returns it. A reset can only
+	// be used once.
+	Use(ctx context.Context, id string) (*PasswordReset, error)
+}
+
+// TwoFactorRepo stores the second factors of users and their recovery
+// codes. Enabling and disabling is audited.
+type TwoFactorRepo interface {
+	Get(ctx context.Context, userID string) (*TwoFactor, error)
+	// Begin stores the pending second factor tf, replacing a pending one.
+	// It returns ErrTwoFactorEnabled if the user has one enabled.
+	Begin(ctx context.Context, tf *TwoFactor) error
+	// Enable enables the pending second factor of a user, whose first
+	// code was of step, and replaces the recovery codes with codes.
+	Enable(ctx context.Context, userID string, step int64, codes []string) error
+	// Disable deletes the second factor and the recovery codes of a user.
+	Disable(ctx context.Context, userID string) error
+	// UseStep records that a code of step was accepted. It reports false
+	// if a code of that step or a later one was accepted before.
+	UseStep(ctx context.Context, userID string, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code of the user as used.
+	UseRecoveryCode(ctx context.Context, userID, code string) error
+	// RecoveryCodesLeft returns how many unused recovery codes the user
+	// has.
+	RecoveryCodesLeft(ctx context.Context, userID string) (int, error)
+}
+
+// IdentityRepo stores the OAuth identities linked to users.
+type IdentityRepo interface {
+	Get(ctx context.Context, provider, subject string) (*Identity, error)
+	// Link stores id and audits it.
+	Link(ctx context.Context, id *Identity) error
+}
+
+// APIKeyRepo stores API keys. Create and Revoke are audited.
+type APIKeyRepo interface {
+	// GetByHash returns the valid key with the hash.
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	// List returns the keys of an account that aren't revoked, newest
+	// first. Expired keys are included.
+	List(ctx context.Context, accountID int64) ([]APIKey, error)
+	// Create stores k and sets its id.
+	Create(ctx context.Context, k *APIKey) error
+	// Revoke revokes a key of an account, or returns sql.ErrNoRows.
+	Revoke(ctx context.Context, accountID, id int64) error
+	// Touch records that the key was used from ip at at.
+	Touch(ctx context.Context, id int64, ip string, at time.Time) error
+}
+
+// HostRepo stores hosts. It only sees the hosts of the account the context
+// is scoped to with WithAccount and returns ErrNoAccount without one. Every
+// change is audited.
+type HostRepo interface {
+	Get(ctx context.Context, id int) (*Host, error)
+	List(ctx context.Context, spec filter.Spec) (filter.Page[Host], error)
+	Create(ctx context.Context, h *Host) error
+	Update(ctx context.Context, h *Host) error
+	// Delete deletes the host together with its services.
+	Delete(ctx context.Context, id int) error
+}
+
+// HostServiceRepo stores the services monitored on hosts. Like HostRepo it
+// is scoped to the account of the context, except for ListMonitored. Every
+// change is audited.
+type HostServiceRepo interface {
+	Get(ctx context.Context, id int) (*HostService, error)
+	List(ctx context.Context, spec filter.Spec) (filter.Page[HostService], error)
+	// ListMonitored returns every active host service of an active host of
+	// every account, for the scheduler.
+	ListMonitored(ctx context.Context) ([]MonitoredService, error)
+	// RecordCheck stores the outcome of a check of s, and an event when
+	// it changed the status. Like ListMonitored it isn't scoped.
+	RecordCheck(ctx context.Context, s MonitoredService, status, message string, at time.Time) error
+	Create(ctx context.Context, hs *HostService) error
+	Update(ctx context.Context, hs *HostService) error
+	Delete(ctx context.Context, id int) error
+}
+
+// EventRepo stores the monitoring events of host services. List is scoped
+// to the account of the context.
+type EventRepo interface {
+	// Create records an event of the monitor, which isn't scoped.
+	Create(ctx context.Context, e *Event) error
+	List(ctx context.Context, spec filter.Spec) (filter.Page[Event], error)
+}
+
+// AuditRepo stores the audit log.
+type AuditRepo interface {
+	// Record appends rec attributed to the actor of ctx.
+	Record(ctx context.Context, rec AuditRecord) error
+	// List returns the entries visible in scope.
+	List(ctx context.Context, scope AuditScope, spec filter.Spec) (filter.Page[AuditEntry], error)
+}
+
+// Publisher publishes application events on the event bus.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, v any) error
+}
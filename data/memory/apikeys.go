@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type apiKeyRepo struct{ s *Store }
+
+func (r apiKeyRepo) GetByHash(ctx context.Context, hash string) (*data.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, k := range r.s.APIKeys {
+		if k.Hash == hash && k.Valid(time.Now()) {
+			return clone(k), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r apiKeyRepo) List(ctx context.Context, accountID int64) ([]data.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var keys []data.APIKey
+	for _, k := range r.s.APIKeys {
+		if k.AccountID == accountID && k.RevokedAt == nil {
+			keys = append(keys, *k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys, nil
+}
+
+func (r apiKeyRepo) Create(ctx context.Context, k *data.APIKey) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	k.ID = r.s.id()
+	r.s.APIKeys[k.ID] = clone(k)
+	r.s.audit(ctx, data.APIKeyAuditRecord(data.AuditAPIKeyCreate, k))
+	return nil
+}
+
+func (r apiKeyRepo) Revoke(ctx context.Context, accountID, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	k, ok := r.s.APIKeys[id]
+	if !ok || k.AccountID != accountID || k.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	k.RevokedAt = &now
+	r.s.audit(ctx, data.APIKeyAuditRecord(data.AuditAPIKeyRevoke, k))
+	return nil
+}
+
+func (r apiKeyRepo) Touch(ctx context.Context, id int64, ip string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	k, ok := r.s.APIKeys[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	k.LastUsedAt, k.LastUsedIP = &at, ip
+	return nil
+}
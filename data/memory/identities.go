@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type identityRepo struct{ s *Store }
+
+func (r identityRepo) Get(ctx context.Context, provider, subject string) (*data.Identity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, id := range r.s.Identities {
+		if id.Provider == provider && id.Subject == subject {
+			return clone(&id), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r identityRepo) Link(ctx context.Context, id *data.Identity) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, old := range r.s.Identities {
+		if old.Provider == id.Provider && old.Subject == id.Subject {
+			return errors.New("memory: identity already linked")
+		}
+	}
+	if id.CreatedAt.IsZero() {
+		id.CreatedAt = time.Now()
+	}
+	r.s.Identities = append(r.s.Identities, *id)
+	r.s.audit(ctx, data.IdentityAuditRecord(data.AuditIdentityLink, id))
+	return nil
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type memberRepo struct{ s *Store }
+
+func (r memberRepo) Memberships(ctx context.Context, userID string) ([]data.Membership, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var ms []data.Membership
+	for _, m := range r.s.Members {
+		if m.UserID == userID {
+			if acc, ok := r.s.Accounts[m.AccountID]; ok {
+				m.Account = clone(acc)
+			}
+			ms = append(ms, m)
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].CreatedAt.Before(ms[j].CreatedAt) })
+	return ms, nil
+}
+
+func (r memberRepo) List(ctx context.Context, accountID int64) ([]data.Membership, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var ms []data.Membership
+	for _, m := range r.s.Members {
+		if m.AccountID == accountID {
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
+
+func (r memberRepo) Remove(ctx context.Context, accountID int64, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	idx, owners := -1, 0
+	for i, m := range r.s.Members {
+		if m.AccountID != accountID {
+			continue
+		}
+		if m.UserID == userID {
+			idx = i
+		}
+		if m.AccessLevel == data.RoleOwner {
+			owners++
+		}
+	}
+	if idx < 0 {
+		return sql.ErrNoRows
+	}
+	m := r.s.Members[idx]
+	if m.AccessLevel == data.RoleOwner && owners == 1 {
+		return data.ErrLastOwner
+	}
+	r.s.Members = append(r.s.Members[:idx], r.s.Members[idx+1:]...)
+	r.s.audit(ctx, data.MemberAuditRecord(data.AuditMemberRemove, accountID, userID, &m, nil))
+	return nil
+}
+
+func (r memberRepo) SetRole(ctx context.Context, accountID int64, userID string, role data.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	idx, owners := -1, 0
+	for i, m := range r.s.Members {
+		if m.AccountID != accountID {
+			continue
+		}
+		if m.UserID == userID {
+			idx = i
+		}
+		if m.AccessLevel == data.RoleOwner {
+			owners++
+		}
+	}
+	if idx < 0 {
+		return sql.ErrNoRows
+	}
+	before := r.s.Members[idx]
+	if before.AccessLevel == data.RoleOwner && owners == 1 && role != data.RoleOwner {
+		return data.ErrLastOwner
+	}
+	r.s.Members[idx].AccessLevel = role
+	r.s.audit(ctx, data.MemberAuditRecord(data.AuditMemberRoleChange, accountID, userID, &before, &r.s.Members[idx]))
+	return nil
+}
+
+func (r memberRepo) Invite(ctx context.Context, inv *data.Invitation) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	invs := r.s.Invitations[:0]
+	for _, i := range r.s.Invitations {
+		if i.AccountID != inv.AccountID || i.AcceptedAt != nil || !strings.EqualFold(i.Email, inv.Email) {
+			invs = append(invs, i)
+		}
+	}
+	inv.ID = r.s.id()
+	inv.CreatedAt = time.Now()
+	inv.ExpiresAt = inv.CreatedAt.Add(data.InvitationTTL)
+	r.s.Invitations = append(invs, *inv)
+	r.s.audit(ctx, data.MemberAuditRecord(data.AuditMemberInvite, inv.AccountID, inv.Email, nil, inv))
+	return nil
+}
+
+func (r memberRepo) Invitations(ctx context.Context, accountID int64) ([]data.Invitation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var invs []data.Invitation
+	for _, inv := range r.s.Invitations {
+		if inv.AccountID == accountID && inv.Pending(time.Now()) {
+			invs = append(invs, inv)
+		}
+	}
+	return invs, nil
+}
+
+func (r memberRepo) InvitationsFor(ctx context.Context, email string) ([]data.Invitation, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var invs []data.Invitation
+	for _, inv := range r.s.Invitations {
+		if inv.For(email) && inv.Pending(time.Now()) {
+			if acc, ok := r.s.Accounts[inv.AccountID]; ok {
+				inv.Account = clone(acc)
+			}
+			invs = append(invs, inv)
+		}
+	}
+	return invs, nil
+}
+
+func (r memberRepo) Accept(ctx context.Context, id int64, userID, email string) (*data.Membership, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.Invitations {
+		inv := &r.s.Invitations[i]
+		if inv.ID != id {
+			continue
+		}
+		if !inv.Pending(time.Now()) || !inv.For(email) {
+			return nil, data.ErrInvitation
+		}
+		now := time.Now()
+		inv.AcceptedAt = &now
+		for _, m := range r.s.Members {
+			if m.AccountID == inv.AccountID && m.UserID == userID {
+				return &m, nil
+			}
+		}
+		m := data.Membership{AccountID: inv.AccountID, UserID: userID, Email: email, AccessLevel: inv.AccessLevel, CreatedAt: now}
+		r.s.Members = append(r.s.Members, m)
+		r.s.audit(ctx, data.MemberAuditRecord(data.AuditMemberJoin, inv.AccountID, userID, nil, &m))
+		return &m, nil
+	}
+	return nil, data.ErrInvitation
+}
+
+func (r memberRepo) Revoke(ctx context.Context, accountID, id int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i, inv := range r.s.Invitations {
+		if inv.ID == id && inv.AccountID == accountID && inv.AcceptedAt == nil {
+			r.s.Invitations = append(r.s.Invitations[:i], r.s.Invitations[i+1:]...)
+			r.s.audit(ctx, data.MemberAuditRecord(data.AuditInvitationRevoke, accountID, inv.Email, &inv, nil))
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,577 @@
+// Package memory is an in-memory implementation of the data repositories
+// for tests and local development without Postgres.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/event"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/nedpals/supabase-go"
+)
+
+// Store holds every record. Its fields may be seeded directly before the
+// repositories are used.
+type Store struct {
+	mu sync.RWMutex
+
+	Accounts    map[int64]*data.Account
+	Members     []data.Membership
+	Invitations []data.Invitation
+	Users       map[string]*data.User
+	Sessions    map[string]*data.Session
+	Resets      map[string]*data.PasswordReset
+	TwoFactors  map[string]*data.TwoFactor
+	// RecoveryCodes are keyed by their id.
+	RecoveryCodes map[string]*data.RecoveryCode
+	Identities    []data.Identity
+	APIKeys       map[int64]*data.APIKey
+	Hosts         map[int]*data.Host
+	Services      map[int]*data.Services
+	HostServices  map[int]*data.HostService
+	Events        []data.Event
+	AuditLog      []data.AuditEntry
+	// Published records every event passed to the publisher.
+	Published []Published
+
+	nextID int64
+}
+
+// Published is an event passed to the publisher.
+type Published struct {
+	Topic string
+	Value any
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{
+		Accounts:      make(map[int64]*data.Account),
+		Users:         make(map[string]*data.User),
+		Sessions:      make(map[string]*data.Session),
+		Resets:        make(map[string]*data.PasswordReset),
+		TwoFactors:    make(map[string]*data.TwoFactor),
+		RecoveryCodes: make(map[string]*data.RecoveryCode),
+		APIKeys:       make(map[int64]*data.APIKey),
+		Hosts:         make(map[int]*data.Host),
+		Services:      make(map[int]*data.Services),
+		HostServices:  make(map[int]*data.HostService),
+	}
+}
+
+// NewRepos returns repositories backed by s.
+func NewRepos(s *Store) *data.Repos {
+	return &data.Repos{
+		Accounts:     accountRepo{s},
+		Members:      memberRepo{s},
+		Users:        userRepo{s},
+		Sessions:     sessionRepo{s},
+		Resets:       passwordResetRepo{s},
+		TwoFactor:    twoFactorRepo{s},
+		Identities:   identityRepo{s},
+		APIKeys:      apiKeyRepo{s},
+		Hosts:        hostRepo{s},
+		HostServices: hostServiceRepo{s},
+		Events:       eventRepo{s},
+		Audit:        auditRepo{s},
+		Publisher:    publisher{s},
+		Tx:           transactor{s},
+	}
+}
+
+// id returns the next id. s.mu must be held.
+func (s *Store) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// audit appends rec to the audit log. s.mu must be held.
+func (s *Store) audit(ctx context.Context, rec data.AuditRecord) {
+	e := data.NewAuditEntry(data.ActorFrom(ctx), rec)
+	e.ID = s.id()
+	e.CreatedAt = time.Now()
+	s.AuditLog = append(s.AuditLog, *e)
+}
+
+// tenant returns the account ctx is scoped to, like the Postgres
+// repositories do.
+func tenant(ctx context.Context) (int64, error) {
+	if id := data.AccountFrom(ctx); id != 0 {
+		return id, nil
+	}
+	return 0, data.ErrNoAccount
+}
+
+func clone[T any](v *T) *T {
+	c := *v
+	return &c
+}
+
+type accountRepo struct{ s *Store }
+
+func (r accountRepo) Get(ctx context.Context, id int64) (*data.Account, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if acc, ok := r.s.Accounts[id]; ok {
+		return clone(acc), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r accountRepo) GetByUserID(ctx context.Context, userID string) (*data.Account, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var found *data.Account
+	for _, acc := range r.s.Accounts {
+		if acc.UserID == userID && (found == nil || acc.ID < found.ID) {
+			found = acc
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	return clone(found), nil
+}
+
+func (r accountRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[*data.Account], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	accounts := make([]*data.Account, 0, len(r.s.Accounts))
+	for _, acc := range r.s.Accounts {
+		accounts = append(accounts, clone(acc))
+	}
+	return filter.Slice(data.AccountSchema, spec, accounts)
+}
+
+func (r accountRepo) Create(ctx context.Context, user *supabase.User) (*data.Account, error) {
+	r.s.mu.Lock()
+	acc := r.s.createAccount(user)
+	r.s.mu.Unlock()
+
+	event.Emit(data.AccountCreatedEvent, acc)
+	return acc, nil
+}
+
+func (r accountRepo) FirstOrCreate(ctx context.Context, user *supabase.User) (*data.Account, error) {
+	r.s.mu.Lock()
+	for _, m := range r.s.Members {
+		if m.UserID == user.ID {
+			acc := clone(r.s.Accounts[m.AccountID])
+			r.s.mu.Unlock()
+			return acc, nil
+		}
+	}
+	acc := r.s.createAccount(user)
+	r.s.mu.Unlock()
+
+	event.Emit(data.AccountCreatedEvent, acc)
+	return acc, nil
+}
+
+// createAccount adds an account owned by user. s.mu must be held.
+func (s *Store) createAccount(user *supabase.User) *data.Account {
+	acc := data.NewAccount(user)
+	acc.ID = s.id()
+	s.Accounts[acc.ID] = clone(acc)
+	s.Members = append(s.Members, data.Membership{
+		AccountID:   acc.ID,
+		UserID:      user.ID,
+		Email:       user.Email,
+		AccessLevel: data.RoleOwner,
+		CreatedAt:   time.Now(),
+	})
+	return acc
+}
+
+func (r accountRepo) Update(ctx context.Context, acc *data.Account) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	before, ok := r.s.Accounts[acc.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for _, rec := range data.AccountAuditRecords(before, acc) {
+		r.s.audit(ctx, rec)
+	}
+	r.s.Accounts[acc.ID] = clone(acc)
+	return nil
+}
+
+type userRepo struct{ s *Store }
+
+func (r userRepo) Get(ctx context.Context, id string) (*data.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if u, ok := r.s.Users[id]; ok {
+		return clone(u), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r userRepo) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, u := range r.s.Users {
+		if strings.EqualFold(u.Email, email) && u.DeletedAt == nil {
+			return clone(u), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r userRepo) Create(ctx context.Context, u *data.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.Users[u.ID]; !ok {
+		r.s.Users[u.ID] = clone(u)
+	}
+	return nil
+}
+
+func (r userRepo) MarkVerificationSent(ctx context.Context, id string, interval time.Duration) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.Users[id]
+	now := time.Now()
+	if !ok || (u.VerificationSentAt.Valid && u.VerificationSentAt.Time.After(now.Add(-interval))) {
+		return false, nil
+	}
+	u.VerificationSentAt = sql.NullTime{Time: now, Valid: true}
+	return true, nil
+}
+
+func (r userRepo) VerifyEmail(ctx context.Context, id, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.Users[id]
+	if !ok || u.DeletedAt != nil || !strings.EqualFold(u.Email, email) {
+		return sql.ErrNoRows
+	}
+	if u.EmailVerifiedAt.Valid {
+		return nil
+	}
+	before := *u
+	u.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.s.audit(ctx, data.UserAuditRecord(data.AuditEmailVerify, id, &before, u))
+	return nil
+}
+
+type hostRepo struct{ s *Store }
+
+// host returns the host id of the account. s.mu must be held.
+func (s *Store) host(accountID int64, id int) (*data.Host, bool) {
+	h, ok := s.Hosts[id]
+	return h, ok && h.AccountID == accountID
+}
+
+func (r hostRepo) Get(ctx context.Context, id int) (*data.Host, error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if h, ok := r.s.host(accountID, id); ok {
+		return clone(h), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r hostRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[data.Host], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[data.Host]{}, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	hosts := make([]data.Host, 0, len(r.s.Hosts))
+	for _, h := range r.s.Hosts {
+		if h.AccountID == accountID {
+			hosts = append(hosts, *h)
+		}
+	}
+	return filter.Slice(data.HostSchema, spec, hosts)
+}
+
+func (r hostRepo) Create(ctx context.Context, h *data.Host) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	h.ID = int(r.s.id())
+	h.AccountID = accountID
+	h.CreatedAt, h.UpdatedAt = time.Now(), time.Now()
+	r.s.Hosts[h.ID] = clone(h)
+	r.s.audit(ctx, data.HostAuditRecord(data.AuditHostCreate, accountID, h.ID, nil, h))
+	return nil
+}
+
+func (r hostRepo) Update(ctx context.Context, h *data.Host) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	before, ok := r.s.host(accountID, h.ID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	h.AccountID = accountID
+	h.UpdatedAt = time.Now()
+	r.s.Hosts[h.ID] = clone(h)
+	r.s.audit(ctx, data.HostAuditRecord(data.AuditHostUpdate, accountID, h.ID, before, h))
+	return nil
+}
+
+func (r hostRepo) Delete(ctx context.Context, id int) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	before, ok := r.s.host(accountID, id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	for hsID, hs := range r.s.HostServices {
+		if hs.HostID == id {
+			delete(r.s.HostServices, hsID)
+		}
+	}
+	delete(r.s.Hosts, id)
+	r.s.audit(ctx, data.HostAuditRecord(data.AuditHostDelete, accountID, id, before, nil))
+	return nil
+}
+
+type hostServiceRepo struct{ s *Store }
+
+// withService fills the relations of hs. s.mu must be held.
+func (s *Store) withService(hs *data.HostService) *data.HostService {
+	hs = clone(hs)
+	if svc, ok := s.Services[hs.ServiceID]; ok {
+		hs.Service = *svc
+	}
+	if h, ok := s.Hosts[hs.HostID]; ok {
+		hs.HostName = h.HostName
+	}
+	return hs
+}
+
+// hostService returns the host service id of the account. s.mu must be
+// held.
+func (s *Store) hostService(accountID int64, id int) (*data.HostService, bool) {
+	hs, ok := s.HostServices[id]
+	if !ok {
+		return nil, false
+	}
+	_, ok = s.host(accountID, hs.HostID)
+	return hs, ok
+}
+
+func (r hostServiceRepo) Get(ctx context.Context, id int) (*data.HostService, error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if hs, ok := r.s.hostService(accountID, id); ok {
+		return r.s.withService(hs), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r hostServiceRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[data.HostService], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[data.HostService]{}, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	services := make([]data.HostService, 0, len(r.s.HostServices))
+	for id := range r.s.HostServices {
+		if hs, ok := r.s.hostService(accountID, id); ok {
+			services = append(services, *r.s.withService(hs))
+		}
+	}
+	return filter.Slice(data.HostServiceSchema, spec, services)
+}
+
+func (r hostServiceRepo) ListMonitored(ctx context.Context) ([]data.MonitoredService, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var services []data.MonitoredService
+	for _, hs := range r.s.HostServices {
+		h, ok := r.s.Hosts[hs.HostID]
+		svc, ok2 := r.s.Services[hs.ServiceID]
+		if !ok || !ok2 || hs.Active != 1 || h.Active != 1 {
+			continue
+		}
+		url := "https://" + h.HostName
+		if h.URL != nil {
+			url = *h.URL
+		}
+		services = append(services, data.MonitoredService{
+			HostServiceID:  hs.ID,
+			AccountID:      h.AccountID,
+			HostID:         h.ID,
+			HostName:       h.HostName,
+			ServiceName:    svc.ServiceName,
+			URL:            url,
+			ScheduleNumber: hs.ScheduleNumber,
+			ScheduleUnit:   hs.ScheduleUnit,
+		})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].HostServiceID < services[j].HostServiceID })
+	return services, nil
+}
+
+func (r hostServiceRepo) RecordCheck(ctx context.Context, s data.MonitoredService, status, message string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	hs, ok := r.s.HostServices[s.HostServiceID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	previous := hs.Status
+	hs.Status, hs.LastCheck, hs.LastMessage = status, at, message
+	if previous != status {
+		e := data.CheckEvent(s, status, message, at)
+		e.ID = int(r.s.id())
+		r.s.Events = append(r.s.Events, *e)
+	}
+	return nil
+}
+
+func (r hostServiceRepo) Create(ctx context.Context, hs *data.HostService) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.host(accountID, hs.HostID); !ok {
+		return sql.ErrNoRows
+	}
+	hs.ID = int(r.s.id())
+	hs.CreatedAt, hs.UpdatedAt = time.Now(), time.Now()
+	r.s.HostServices[hs.ID] = clone(hs)
+	r.s.audit(ctx, data.HostServiceAuditRecord(data.AuditServiceCreate, accountID, hs.ID, nil, hs))
+	return nil
+}
+
+func (r hostServiceRepo) Update(ctx context.Context, hs *data.HostService) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	before, ok := r.s.hostService(accountID, hs.ID)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := r.s.host(accountID, hs.HostID); !ok {
+		return sql.ErrNoRows
+	}
+	hs.UpdatedAt = time.Now()
+	r.s.HostServices[hs.ID] = clone(hs)
+	r.s.audit(ctx, data.HostServiceAuditRecord(data.AuditServiceUpdate, accountID, hs.ID, before, hs))
+	return nil
+}
+
+func (r hostServiceRepo) Delete(ctx context.Context, id int) error {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	before, ok := r.s.hostService(accountID, id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.s.HostServices, id)
+	r.s.audit(ctx, data.HostServiceAuditRecord(data.AuditServiceDelete, accountID, id, before, nil))
+	return nil
+}
+
+type eventRepo struct{ s *Store }
+
+func (r eventRepo) Create(ctx context.Context, e *data.Event) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	e.ID = int(r.s.id())
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.UpdatedAt = e.CreatedAt
+	r.s.Events = append(r.s.Events, *e)
+	return nil
+}
+
+func (r eventRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[data.Event], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[data.Event]{}, err
+	}
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var events []data.Event
+	for _, e := range r.s.Events {
+		if _, ok := r.s.host(accountID, e.HostID); ok {
+			events = append(events, e)
+		}
+	}
+	return filter.Slice(data.EventSchema, spec, events)
+}
+
+type auditRepo struct{ s *Store }
+
+func (r auditRepo) Record(ctx context.Context, rec data.AuditRecord) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.audit(ctx, rec)
+	return nil
+}
+
+func (r auditRepo) List(ctx context.Context, scope data.AuditScope, spec filter.Spec) (filter.Page[data.AuditEntry], error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var entries []data.AuditEntry
+	for i := range r.s.AuditLog {
+		if scope.Match(&r.s.AuditLog[i]) {
+			entries = append(entries, r.s.AuditLog[i])
+		}
+	}
+	return filter.Slice(data.AuditSchema, spec, entries)
+}
+
+// transactor runs work on the store itself, which has no transactions: a
+// failing fn keeps the changes it made before.
+type transactor struct{ s *Store }
+
+func (t transactor) InTx(ctx context.Context, fn func(ctx context.Context, r *data.Repos) error) error {
+	return fn(ctx, NewRepos(t.s))
+}
+
+// publisher records events and emits them on the in-memory event bus.
+type publisher struct{ s *Store }
+
+func (p publisher) Publish(ctx context.Context, topic string, v any) error {
+	p.s.mu.Lock()
+	p.s.Published = append(p.s.Published, Published{Topic: topic, Value: v})
+	p.s.mu.Unlock()
+	event.Emit(topic, v)
+	return nil
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type passwordResetRepo struct{ s *Store }
+
+func (r passwordResetRepo) Get(ctx context.Context, id string) (*data.PasswordReset, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if reset, ok := r.s.Resets[id]; ok && reset.Valid(time.Now()) {
+		return clone(reset), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r passwordResetRepo) Create(ctx context.Context, reset *data.PasswordReset, interval time.Duration) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	since := time.Now().Add(-interval)
+	for _, old := range r.s.Resets {
+		if old.UserID == reset.UserID && old.CreatedAt.After(since) {
+			return false, nil
+		}
+	}
+	for id, old := range r.s.Resets {
+		if old.UserID == reset.UserID && old.UsedAt == nil {
+			delete(r.s.Resets, id)
+		}
+	}
+	r.s.Resets[reset.ID] = clone(reset)
+	return true, nil
+}
+
+func (r passwordResetRepo) Use(ctx context.Context, id string) (*data.PasswordReset, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	now := time.Now()
+	reset, ok := r.s.Resets[id]
+	if !ok || !reset.Valid(now) {
+		return nil, sql.ErrNoRows
+	}
+	reset.UsedAt = &now
+	return clone(reset), nil
+}
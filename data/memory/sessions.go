@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type sessionRepo struct{ s *Store }
+
+func (r sessionRepo) Get(ctx context.Context, id string) (*data.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if sess, ok := r.s.Sessions[id]; ok && !sess.Expired(time.Now()) {
+		return clone(sess), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r sessionRepo) List(ctx context.Context, userID string) ([]data.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var ss []data.Session
+	for _, sess := range r.s.Sessions {
+		if sess.UserID == userID && !sess.Pending && !sess.Expired(time.Now()) {
+			ss = append(ss, *sess)
+		}
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].LastSeenAt.After(ss[j].LastSeenAt) })
+	return ss, nil
+}
+
+func (r sessionRepo) Create(ctx context.Context, sess *data.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.s.Sessions[sess.ID] = clone(sess)
+	return nil
+}
+
+func (r sessionRepo) Update(ctx context.Context, sess *data.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.Sessions[sess.ID]; !ok {
+		return sql.ErrNoRows
+	}
+	r.s.Sessions[sess.ID] = clone(sess)
+	return nil
+}
+
+func (r sessionRepo) Fail(ctx context.Context, id string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	sess, ok := r.s.Sessions[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	sess.FailedAttempts++
+	return sess.FailedAttempts, nil
+}
+
+func (r sessionRepo) Revoke(ctx context.Context, userID, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if sess, ok := r.s.Sessions[id]; !ok || sess.UserID != userID {
+		return sql.ErrNoRows
+	}
+	delete(r.s.Sessions, id)
+	r.s.audit(ctx, data.SessionAuditRecord(data.AuditSessionRevoke, id))
+	return nil
+}
+
+func (r sessionRepo) RevokeAll(ctx context.Context, userID, except string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, sess := range r.s.Sessions {
+		if sess.UserID == userID && id != except {
+			delete(r.s.Sessions, id)
+		}
+	}
+	r.s.audit(ctx, data.SessionAuditRecord(data.AuditSessionRevokeAll, userID))
+	return nil
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+)
+
+type twoFactorRepo struct{ s *Store }
+
+func (r twoFactorRepo) Get(ctx context.Context, userID string) (*data.TwoFactor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if tf, ok := r.s.TwoFactors[userID]; ok {
+		return clone(tf), nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r twoFactorRepo) Begin(ctx context.Context, tf *data.TwoFactor) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if old, ok := r.s.TwoFactors[tf.UserID]; ok && old.Enabled() {
+		return data.ErrTwoFactorEnabled
+	}
+	r.s.TwoFactors[tf.UserID] = clone(tf)
+	return nil
+}
+
+func (r twoFactorRepo) Enable(ctx context.Context, userID string, step int64, codes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	tf, ok := r.s.TwoFactors[userID]
+	if !ok || tf.Enabled() {
+		return data.ErrTwoFactorEnabled
+	}
+	now := time.Now()
+	tf.EnabledAt, tf.LastStep = &now, step
+	r.s.replaceRecoveryCodes(userID, codes)
+	r.s.audit(ctx, data.TwoFactorAuditRecord(data.AuditTwoFactorEnable, userID))
+	return nil
+}
+
+func (r twoFactorRepo) Disable(ctx context.Context, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.TwoFactors[userID]; !ok {
+		return nil
+	}
+	delete(r.s.TwoFactors, userID)
+	r.s.replaceRecoveryCodes(userID, nil)
+	r.s.audit(ctx, data.TwoFactorAuditRecord(data.AuditTwoFactorDisable, userID))
+	return nil
+}
+
+func (r twoFactorRepo) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	tf, ok := r.s.TwoFactors[userID]
+	if !ok || tf.LastStep >= step {
+		return false, nil
+	}
+	tf.LastStep = step
+	return true, nil
+}
+
+func (r twoFactorRepo) UseRecoveryCode(ctx context.Context, userID, code string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	rc, ok := r.s.RecoveryCodes[data.RecoveryCodeID(code)]
+	if !ok || rc.UserID != userID || rc.UsedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	rc.UsedAt = &now
+	return nil
+}
+
+func (r twoFactorRepo) RecoveryCodesLeft(ctx context.Context, userID string) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	n := 0
+	for _, rc := range r.s.RecoveryCodes {
+		if rc.UserID == userID && rc.UsedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// replaceRecoveryCodes replaces the recovery codes of a user. s.mu must be
+// held.
+func (s *Store) replaceRecoveryCodes(userID string, codes []string) {
+	for id, rc := range s.RecoveryCodes {
+		if rc.UserID == userID {
+			delete(s.RecoveryCodes, id)
+		}
+	}
+	for _, c := range codes {
+		id := data.RecoveryCodeID(c)
+		s.RecoveryCodes[id] = &data.RecoveryCode{ID: id, UserID: userID}
+	}
+}
@@ -0,0 +1,281 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// InvitationTTL is how long an invitation can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// InvitationCreatedEvent is published with an InvitationCreated when a user
+// is invited to an account.
+const InvitationCreatedEvent = "account.invitation.created"
+
+var (
+	// ErrNoAccount is returned by the account scoped repositories when the
+	// context carries no account.
+	ErrNoAccount = errors.New("data: no account in context")
+	// ErrLastOwner is returned when removing the last owner of an account.
+	ErrLastOwner = errors.New("data: an account needs an owner")
+	// ErrInvitation is returned for invitations that don't exist, have
+	// expired or are addressed to someone else.
+	ErrInvitation = errors.New("data: invalid invitation")
+)
+
+// Membership makes a user a member of an account.
+type Membership struct {
+	bun.BaseModel `bun:"table:memberships"`
+
+	AccountID   int64  `bun:",pk"`
+	UserID      string `bun:",pk"`
+	Email       string
+	AccessLevel Role
+	CreatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	Account     *Account  `bun:"rel:belongs-to,join:account_id=id"`
+}
+
+// Invitation invites an email address to join an account.
+type Invitation struct {
+	bun.BaseModel `bun:"table:invitations"`
+
+	ID          int64 `bun:",pk,autoincrement"`
+	AccountID   int64
+	Email       string
+	AccessLevel Role
+	InvitedBy   string
+	ExpiresAt   time.Time
+	AcceptedAt  *time.Time
+	CreatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	Account     *Account  `bun:"rel:belongs-to,join:account_id=id"`
+}
+
+// Pending reports whether inv can still be accepted.
+func (inv *Invitation) Pending(now time.Time) bool {
+	return inv.AcceptedAt == nil && now.Before(inv.ExpiresAt)
+}
+
+// For reports whether inv is addressed to email.
+func (inv *Invitation) For(email string) bool {
+	return email != "" && strings.EqualFold(inv.Email, email)
+}
+
+// InvitationCreated is the payload of InvitationCreatedEvent.
+type InvitationCreated struct {
+	Invitation   Invitation
+	AccountName  string
+	InviterEmail string
+	// URL is the page the invitation can be accepted on.
+	URL string
+}
+
+type accountKey struct{}
+
+// WithAccount returns a copy of ctx scoped to the account. The host,
+// host service and event repositories only see the records of that
+// account.
+func WithAccount(ctx context.Context, accountID int64) context.Context {
+	return context.WithValue(ctx, accountKey{}, accountID)
+}
+
+// AccountFrom returns the account ctx is scoped to, or 0.
+func AccountFrom(ctx context.Context) int64 {
+	id, _ := ctx.Value(accountKey{}).(int64)
+	return id
+}
+
+// tenant returns the account ctx is scoped to. Scoped repositories refuse
+// to work without one rather than returning the records of every account.
+func tenant(ctx context.Context) (int64, error) {
+	if id := AccountFrom(ctx); id != 0 {
+		return id, nil
+	}
+	return 0, ErrNoAccount
+}
+
+// MemberAuditRecord returns the audit record of a membership change.
+func MemberAuditRecord(action string, accountID int64, target string, before, after any) AuditRecord {
+	return AuditRecord{
+		Action:     action,
+		AccountID:  &accountID,
+		TargetType: "member",
+		TargetID:   target,
+		Before:     before,
+		After:      after,
+	}
+}
+
+type memberRepo struct {
+	db bun.IDB
+}
+
+func (r memberRepo) Memberships(ctx context.Context, userID string) ([]Membership, error) {
+	var ms []Membership
+	err := r.db.NewSelect().Model(&ms).Relation("Account").
+		Where("membership.user_id = ?", userID).
+		Order("membership.created_at", "membership.account_id").
+		Scan(ctx)
+	return ms, err
+}
+
+func (r memberRepo) List(ctx context.Context, accountID int64) ([]Membership, error) {
+	var ms []Membership
+	err := r.db.NewSelect().Model(&ms).
+		Where("account_id = ?", accountID).
+		Order("created_at", "user_id").
+		Scan(ctx)
+	return ms, err
+}
+
+func (r memberRepo) Remove(ctx context.Context, accountID int64, userID string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var ms []Membership
+		// Lock every membership so two owners can't remove each other.
+		if err := tx.NewSelect().Model(&ms).Where("account_id = ?", accountID).For("UPDATE").Scan(ctx); err != nil {
+			return err
+		}
+		m, err := removable(ms, userID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model(m).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, MemberAuditRecord(AuditMemberRemove, accountID, userID, m, nil))
+	})
+}
+
+func (r memberRepo) SetRole(ctx context.Context, accountID int64, userID string, role Role) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var ms []Membership
+		if err := tx.NewSelect().Model(&ms).Where("account_id = ?", accountID).For("UPDATE").Scan(ctx); err != nil {
+			return err
+		}
+		m, err := removable(ms, userID)
+		if errors.Is(err, ErrLastOwner) && role == RoleOwner {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		before := *m
+		m.AccessLevel = role
+		if _, err := tx.NewUpdate().Model(m).Column("access_level").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, MemberAuditRecord(AuditMemberRoleChange, accountID, userID, &before, m))
+	})
+}
+
+// removable returns the membership of userID in ms unless it is missing or
+// the last owner, who can neither leave nor be demoted.
+func removable(ms []Membership, userID string) (*Membership, error) {
+	var m *Membership
+	owners := 0
+	for i := range ms {
+		if ms[i].UserID == userID {
+			m = &ms[i]
+		}
+		if ms[i].AccessLevel == RoleOwner {
+			owners++
+		}
+	}
+	if m == nil {
+		return nil, sql.ErrNoRows
+	}
+	if m.AccessLevel == RoleOwner && owners == 1 {
+		return nil, ErrLastOwner
+	}
+	return m, nil
+}
+
+func (r memberRepo) Invite(ctx context.Context, inv *Invitation) error {
+	inv.ExpiresAt = time.Now().Add(InvitationTTL)
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// A new invitation replaces a pending one to the same address.
+		_, err := tx.NewDelete().Model((*Invitation)(nil)).
+			Where("account_id = ? AND lower(email) = lower(?) AND accepted_at IS NULL", inv.AccountID, inv.Email).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(inv).Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, MemberAuditRecord(AuditMemberInvite, inv.AccountID, inv.Email, nil, inv))
+	})
+}
+
+func (r memberRepo) Invitations(ctx context.Context, accountID int64) ([]Invitation, error) {
+	var invs []Invitation
+	err := r.db.NewSelect().Model(&invs).
+		Where("account_id = ? AND accepted_at IS NULL AND expires_at > now()", accountID).
+		Order("created_at").
+		Scan(ctx)
+	return invs, err
+}
+
+func (r memberRepo) InvitationsFor(ctx context.Context, email string) ([]Invitation, error) {
+	var invs []Invitation
+	err := r.db.NewSelect().Model(&invs).Relation("Account").
+		Where("lower(invitation.email) = lower(?)", email).
+		Where("invitation.accepted_at IS NULL AND invitation.expires_at > now()").
+		Order("invitation.created_at").
+		Scan(ctx)
+	return invs, err
+}
+
+func (r memberRepo) Accept(ctx context.Context, id int64, userID, email string) (*Membership, error) {
+	var m *Membership
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		inv := new(Invitation)
+		err := tx.NewSelect().Model(inv).Where("id = ?", id).For("UPDATE").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvitation
+		}
+		if err != nil {
+			return err
+		}
+		if !inv.Pending(time.Now()) || !inv.For(email) {
+			return ErrInvitation
+		}
+
+		now := time.Now()
+		inv.AcceptedAt = &now
+		if _, err := tx.NewUpdate().Model(inv).Column("accepted_at").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		m = &Membership{AccountID: inv.AccountID, UserID: userID, Email: email, AccessLevel: inv.AccessLevel}
+		// Accepting while already a member keeps the current role.
+		if _, err := tx.NewInsert().Model(m).On("CONFLICT DO NOTHING").Exec(ctx); err != nil {
+			return err
+		}
+		if err := tx.NewSelect().Model(m).WherePK().Scan(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, MemberAuditRecord(AuditMemberJoin, inv.AccountID, userID, nil, m))
+	})
+	return m, err
+}
+
+func (r memberRepo) Revoke(ctx context.Context, accountID, id int64) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		inv := new(Invitation)
+		err := tx.NewSelect().Model(inv).
+			Where("id = ? AND account_id = ? AND accepted_at IS NULL", id, accountID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model(inv).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, MemberAuditRecord(AuditInvitationRevoke, accountID, inv.Email, inv, nil))
+	})
+}
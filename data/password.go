@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// PasswordReset is a pending password reset of a user. Like sessions, only
+// the hash of the token mailed to the user is stored.
+type PasswordReset struct {
+	ID        string `bun:",pk"`
+	UserID    string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// NewPasswordReset returns a reset of userID that is valid for ttl and the
+// token that identifies it.
+func NewPasswordReset(userID string, ttl time.Duration) (*PasswordReset, string) {
+	token := newToken()
+	now := time.Now()
+	return &PasswordReset{
+		ID:        PasswordResetID(token),
+		UserID:    userID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, token
+}
+
+// PasswordResetID returns the id of the reset identified by token.
+func PasswordResetID(token string) string {
+	return hashToken(token)
+}
+
+// Valid reports whether the reset can still be used at now.
+func (r *PasswordReset) Valid(now time.Time) bool {
+	return r.UsedAt == nil && now.Before(r.ExpiresAt)
+}
+
+type passwordResetRepo struct {
+	db bun.IDB
+}
+
+func (r passwordResetRepo) Create(ctx context.Context, reset *PasswordReset, interval time.Duration) (bool, error) {
+	var created bool
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Serializes the requests of the user, so only one of them sees
+		// no recent reset.
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", "password_reset:"+reset.UserID); err != nil {
+			return err
+		}
+		recent, err := tx.NewSelect().Model((*PasswordReset)(nil)).
+			Where("user_id = ?", reset.UserID).
+			Where("created_at > ?", time.Now().Add(-interval)).
+			Exists(ctx)
+		if err != nil || recent {
+			return err
+		}
+		// A new link replaces the pending ones.
+		if _, err := tx.NewDelete().Model((*PasswordReset)(nil)).
+			Where("user_id = ?", reset.UserID).
+			Where("used_at IS NULL").
+			Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(reset).Exec(ctx); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func (r passwordResetRepo) Get(ctx context.Context, id string) (*PasswordReset, error) {
+	reset := new(PasswordReset)
+	err := r.db.NewSelect().Model(reset).
+		Where("id = ?", id).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Scan(ctx)
+	return reset, err
+}
+
+func (r passwordResetRepo) Use(ctx context.Context, id string) (*PasswordReset, error) {
+	reset := new(PasswordReset)
+	err := r.db.NewUpdate().Model(reset).
+		Set("used_at = ?", time.Now()).
+		Where("id = ?", id).
+		Where("used_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Returning("*").
+		Scan(ctx)
+	return reset, err
+}
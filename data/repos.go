@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/event"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/uptrace/bun"
+)
+
+// NewBunRepos returns the Postgres implementation of the repositories.
+func NewBunRepos(db *bun.DB) *Repos {
+	return newBunRepos(db)
+}
+
+// newBunRepos returns repositories working on db, which is the database
+// or a transaction of it.
+func newBunRepos(db bun.IDB) *Repos {
+	return &Repos{
+		Accounts:     accountRepo{db: db},
+		Members:      memberRepo{db: db},
+		Users:        userRepo{db: db},
+		Sessions:     sessionRepo{db: db},
+		Resets:       passwordResetRepo{db: db},
+		TwoFactor:    twoFactorRepo{db: db},
+		Identities:   identityRepo{db: db},
+		APIKeys:      apiKeyRepo{db: db},
+		Hosts:        hostRepo{db: db},
+		HostServices: hostServiceRepo{db: db},
+		Events:       eventRepo{db: db},
+		Audit:        auditRepo{db: db},
+		Publisher:    outboxPublisher{db: db},
+		Tx:           transactor{db: db},
+	}
+}
+
+type transactor struct {
+	db bun.IDB
+}
+
+func (t transactor) InTx(ctx context.Context, fn func(ctx context.Context, r *Repos) error) error {
+	return t.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx, newBunRepos(tx))
+	})
+}
+
+type userRepo struct {
+	db bun.IDB
+}
+
+func (r userRepo) Get(ctx context.Context, id string) (*User, error) {
+	user := new(User)
+	err := r.db.NewSelect().Model(user).Where("id = ?", id).Scan(ctx)
+	return user, err
+}
+
+func (r userRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	user := new(User)
+	err := r.db.NewSelect().Model(user).
+		Where("lower(email) = lower(?)", email).
+		Where("deleted_at IS NULL").
+		Scan(ctx)
+	return user, err
+}
+
+func (r userRepo) Create(ctx context.Context, u *User) error {
+	_, err := r.db.NewInsert().Model(u).On("CONFLICT (id) DO NOTHING").Exec(ctx)
+	return err
+}
+
+func (r userRepo) MarkVerificationSent(ctx context.Context, id string, interval time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := r.db.NewUpdate().Model((*User)(nil)).
+		Set("verification_sent_at = ?", now).
+		Where("id = ?", id).
+		Where("verification_sent_at IS NULL OR verification_sent_at <= ?", now.Add(-interval)).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r userRepo) VerifyEmail(ctx context.Context, id, email string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		user := new(User)
+		err := tx.NewSelect().Model(user).
+			Where("id = ?", id).
+			Where("lower(email) = lower(?)", email).
+			Where("deleted_at IS NULL").
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil || user.EmailVerifiedAt.Valid {
+			return err
+		}
+		before := *user
+		user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		if _, err := tx.NewUpdate().Model(user).Column("email_verified_at").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, UserAuditRecord(AuditEmailVerify, id, &before, user))
+	})
+}
+
+// UserAuditRecord describes a change to a local user.
+func UserAuditRecord(action, id string, before, after *User) AuditRecord {
+	rec := AuditRecord{Action: action, TargetType: "user", TargetID: id}
+	if before != nil {
+		rec.Before = userAudit{EmailVerified: before.EmailVerifiedAt.Valid}
+	}
+	if after != nil {
+		rec.After = userAudit{EmailVerified: after.EmailVerifiedAt.Valid}
+	}
+	return rec
+}
+
+// userAudit holds the audited fields of a user. Password hashes and
+// preferences never go to the audit log.
+type userAudit struct {
+	EmailVerified bool
+}
+
+type eventRepo struct {
+	db bun.IDB
+}
+
+func (r eventRepo) Create(ctx context.Context, e *Event) error {
+	_, err := r.db.NewInsert().Model(e).Exec(ctx)
+	return err
+}
+
+func (r eventRepo) List(ctx context.Context, spec filter.Spec) (filter.Page[Event], error) {
+	accountID, err := tenant(ctx)
+	if err != nil {
+		return filter.Page[Event]{}, err
+	}
+	return filter.List[Event](ctx, r.db, EventSchema, spec, func(q *bun.SelectQuery) *bun.SelectQuery {
+		return q.Where("event.host_id IN (SELECT id FROM hosts WHERE account_id = ?)", accountID)
+	})
+}
+
+// outboxPublisher publishes through the transactional outbox, so events
+// survive a restart when it is enabled. Inside Repos.Tx the event is
+// written in the transaction of the change that caused it.
+type outboxPublisher struct {
+	db bun.IDB
+}
+
+func (p outboxPublisher) Publish(ctx context.Context, topic string, v any) error {
+	return event.EmitTx(ctx, p.db, topic, v)
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role is an access level. It is stored as User.AccessLevel and as the
+// access level of a membership, which is what the permissions of a user in
+// an account are taken from.
+type Role int
+
+// Roles, from the least privileged. The zero value is a viewer so a
+// missing level never grants more than read access.
+const (
+	RoleViewer Role = iota
+	RoleBilling
+	RoleEditor
+	RoleAdmin
+	RoleOwner
+)
+
+// Roles lists every role, from the least privileged.
+var Roles = []Role{RoleViewer, RoleBilling, RoleEditor, RoleAdmin, RoleOwner}
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleBilling:
+		return "billing"
+	case RoleEditor:
+		return "editor"
+	case RoleAdmin:
+		return "admin"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("data: unknown role %q", s)
+}
+
+// Permission allows an action, written as resource:action.
+type Permission string
+
+const (
+	PermHostsRead    Permission = "hosts:read"
+	PermHostsWrite   Permission = "hosts:write"
+	PermMembersRead  Permission = "members:read"
+	PermMembersWrite Permission = "members:write"
+	PermBillingRead  Permission = "billing:read"
+	PermBillingWrite Permission = "billing:write"
+	PermAuditRead    Permission = "audit:read"
+	PermAccountWrite Permission = "account:write"
+)
+
+// permissions is the permission matrix.
+var permissions = map[Role][]Permission{
+	RoleViewer:  {PermHostsRead, PermMembersRead},
+	RoleBilling: {PermMembersRead, PermBillingRead, PermBillingWrite},
+	RoleEditor:  {PermHostsRead, PermHostsWrite, PermMembersRead},
+	RoleAdmin: {
+		PermHostsRead, PermHostsWrite, PermMembersRead, PermMembersWrite,
+		PermBillingRead, PermAuditRead, PermAccountWrite,
+	},
+	RoleOwner: {
+		PermHostsRead, PermHostsWrite, PermMembersRead, PermMembersWrite,
+		PermBillingRead, PermBillingWrite, PermAuditRead, PermAccountWrite,
+	},
+}
+
+// Can reports whether r grants p.
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(permissions[r], p)
+}
+
+// Grants reports whether a user with role r may give other to someone.
+// Nobody can hand out more than their own role.
+func (r Role) Grants(other Role) bool {
+	return r.Can(PermMembersWrite) && other <= r
+}
@@ -0,0 +1,55 @@
+package data
+
+import "github.com/NikoMalik/GoTrack/filter"
+
+// The columns of each model that list endpoints may filter and sort on.
+var (
+	AccountSchema = filter.NewSchema(
+		filter.Column{Name: "id", Expr: "account.id", Field: "ID", Kind: filter.Int},
+		filter.Sort{Field: "id"},
+		filter.Column{Name: "user_id", Expr: "account.user_id", Field: "UserID"},
+		filter.Column{Name: "plan", Expr: "account.plan", Field: "Plan", Kind: filter.Int, Sortable: true},
+		filter.Column{Name: "subscription_status", Expr: "account.subscription_status", Field: "SubscriptionStatus"},
+	)
+
+	HostSchema = filter.NewSchema(
+		filter.Column{Name: "id", Expr: "host.id", Field: "ID", Kind: filter.Int},
+		filter.Sort{Field: "host_name"},
+		filter.Column{Name: "host_name", Expr: "host.host_name", Field: "HostName", Sortable: true},
+		filter.Column{Name: "canonical_name", Expr: "host.canonical_name", Field: "CanonicalName", Sortable: true},
+		filter.Column{Name: "active", Expr: "host.active", Field: "Active", Kind: filter.Int},
+		filter.Column{Name: "tag", Expr: "host.tags", Field: "Tags", Kind: filter.Tags},
+		filter.Column{Name: "created_at", Expr: "host.created_at", Field: "CreatedAt", Kind: filter.Time, Sortable: true},
+	)
+
+	HostServiceSchema = filter.NewSchema(
+		filter.Column{Name: "id", Expr: "host_service.id", Field: "ID", Kind: filter.Int},
+		filter.Sort{Field: "id"},
+		filter.Column{Name: "host_id", Expr: "host_service.host_id", Field: "HostID", Kind: filter.Int},
+		filter.Column{Name: "service_id", Expr: "host_service.service_id", Field: "ServiceID", Kind: filter.Int},
+		filter.Column{Name: "service", Expr: "service.service_name", Field: "Service.ServiceName"},
+		filter.Column{Name: "status", Expr: "host_service.status", Field: "Status", Sortable: true},
+		filter.Column{Name: "active", Expr: "host_service.active", Field: "Active", Kind: filter.Int},
+		filter.Column{Name: "last_check", Expr: "host_service.last_check", Field: "LastCheck", Kind: filter.Time, Sortable: true},
+	)
+
+	EventSchema = filter.NewSchema(
+		filter.Column{Name: "id", Expr: "event.id", Field: "ID", Kind: filter.Int},
+		filter.Sort{Field: "created_at", Desc: true},
+		filter.Column{Name: "host_id", Expr: "event.host_id", Field: "HostID", Kind: filter.Int},
+		filter.Column{Name: "host_service_id", Expr: "event.host_service_id", Field: "HostServiceID", Kind: filter.Int},
+		filter.Column{Name: "event_type", Expr: "event.event_type", Field: "EventType"},
+		filter.Column{Name: "service", Expr: "event.service_name", Field: "ServiceName"},
+		filter.Column{Name: "created_at", Expr: "event.created_at", Field: "CreatedAt", Kind: filter.Time, Sortable: true},
+	)
+
+	AuditSchema = filter.NewSchema(
+		filter.Column{Name: "id", Expr: "audit_entry.id", Field: "ID", Kind: filter.Int},
+		filter.Sort{Field: "created_at", Desc: true},
+		filter.Column{Name: "action", Expr: "audit_entry.action", Field: "Action"},
+		filter.Column{Name: "target_type", Expr: "audit_entry.target_type", Field: "TargetType"},
+		filter.Column{Name: "target_id", Expr: "audit_entry.target_id", Field: "TargetID"},
+		filter.Column{Name: "actor_email", Expr: "audit_entry.actor_email", Field: "ActorEmail"},
+		filter.Column{Name: "created_at", Expr: "audit_entry.created_at", Field: "CreatedAt", Kind: filter.Time, Sortable: true},
+	)
+)
@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// SessionIdleTimeout is how long a session lasts without being used.
+const SessionIdleTimeout = 30 * 24 * time.Hour
+
+// Session is a signed in browser. It keeps the Supabase refresh token on
+// the server, encrypted with the key of SetSessionKey, the browser only
+// gets a random token. The id is the hash of that token, so it can be
+// shown and used in urls.
+type Session struct {
+	ID           string `bun:",pk"`
+	UserID       string
+	RefreshToken string `json:"-"`
+	IP           string `bun:"ip"`
+	UserAgent    string
+	CreatedAt    time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	LastSeenAt   time.Time
+	// Pending is set while the user still has to enter their second
+	// factor. A pending session doesn't sign anyone in.
+	Pending bool
+	// FailedAttempts counts the wrong second factors entered for a
+	// pending session.
+	FailedAttempts int
+}
+
+// NewSession returns a session of userID and the token that identifies it.
+func NewSession(userID, refreshToken, ip, userAgent string) (*Session, string) {
+	token := newToken()
+	now := time.Now()
+	return &Session{
+		ID:           SessionID(token),
+		UserID:       userID,
+		RefreshToken: refreshToken,
+		IP:           ip,
+		UserAgent:    userAgent,
+		CreatedAt:    now,
+		LastSeenAt:   now,
+	}, token
+}
+
+// SessionID returns the id of the session identified by token.
+func SessionID(token string) string {
+	return hashToken(token)
+}
+
+// newToken returns a random token for a link or cookie.
+func newToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// hashToken returns the hash of token that is stored in its place.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sealedPrefix marks an encrypted refresh token. Tokens stored before
+// they were encrypted are read as they are and sealed on their next update.
+const sealedPrefix = "v1:"
+
+var (
+	sessionAEAD cipher.AEAD
+	// ErrNoSessionKey is returned when sessions are stored before
+	// SetSessionKey was called.
+	ErrNoSessionKey = errors.New("data: no session key set")
+)
+
+// SetSessionKey sets the AES-256 key refresh tokens of sessions are
+// encrypted with in the database.
+func SetSessionKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	sessionAEAD = aead
+	return nil
+}
+
+// sealToken encrypts the refresh token of session id. The id is
+// authenticated with it, so a token can't be moved to another session.
+func sealToken(id, token string) (string, error) {
+	if sessionAEAD == nil {
+		return "", ErrNoSessionKey
+	}
+	nonce := make([]byte, sessionAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := sessionAEAD.Seal(nonce, nonce, []byte(token), []byte(id))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// openToken decrypts a refresh token sealed by sealToken.
+func openToken(id, sealed string) (string, error) {
+	b64, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return sealed, nil
+	}
+	if sessionAEAD == nil {
+		return "", ErrNoSessionKey
+	}
+	b, err := base64.RawStdEncoding.DecodeString(b64)
+	if err != nil || len(b) < sessionAEAD.NonceSize() {
+		return "", errors.New("data: malformed refresh token")
+	}
+	n := sessionAEAD.NonceSize()
+	token, err := sessionAEAD.Open(nil, b[:n], b[n:], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("data: open refresh token: %w", err)
+	}
+	return string(token), nil
+}
+
+// sealed returns a copy of s to store, with the refresh token encrypted.
+func (s *Session) sealed() (*Session, error) {
+	row := *s
+	var err error
+	row.RefreshToken, err = sealToken(s.ID, s.RefreshToken)
+	return &row, err
+}
+
+// open decrypts the refresh token of a session read from the database.
+func (s *Session) open() error {
+	var err error
+	s.RefreshToken, err = openToken(s.ID, s.RefreshToken)
+	return err
+}
+
+// Expired reports whether the session was idle for too long at now.
+func (s *Session) Expired(now time.Time) bool {
+	return now.Sub(s.LastSeenAt) > SessionIdleTimeout
+}
+
+// SessionAuditRecord describes a change to a session of a user.
+func SessionAuditRecord(action, id string) AuditRecord {
+	return AuditRecord{Action: action, TargetType: "session", TargetID: id}
+}
+
+type sessionRepo struct {
+	db bun.IDB
+}
+
+func (r sessionRepo) Get(ctx context.Context, id string) (*Session, error) {
+	s := new(Session)
+	err := r.db.NewSelect().Model(s).
+		Where("id = ?", id).
+		Where("last_seen_at > ?", time.Now().Add(-SessionIdleTimeout)).
+		Scan(ctx)
+	if err != nil {
+		return s, err
+	}
+	return s, s.open()
+}
+
+func (r sessionRepo) List(ctx context.Context, userID string) ([]Session, error) {
+	var ss []Session
+	err := r.db.NewSelect().Model(&ss).
+		Where("user_id = ?", userID).
+		Where("NOT pending").
+		Where("last_seen_at > ?", time.Now().Add(-SessionIdleTimeout)).
+		Order("last_seen_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ss {
+		if err := ss[i].open(); err != nil {
+			return nil, err
+		}
+	}
+	return ss, nil
+}
+
+func (r sessionRepo) Create(ctx context.Context, s *Session) error {
+	row, err := s.sealed()
+	if err != nil {
+		return err
+	}
+	_, err = r.db.NewInsert().Model(row).Exec(ctx)
+	return err
+}
+
+func (r sessionRepo) Update(ctx context.Context, s *Session) error {
+	row, err := s.sealed()
+	if err != nil {
+		return err
+	}
+	_, err = r.db.NewUpdate().Model(row).
+		Column("refresh_token", "ip", "user_agent", "last_seen_at", "pending").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func (r sessionRepo) Fail(ctx context.Context, id string) (int, error) {
+	var n int
+	err := r.db.NewUpdate().Model((*Session)(nil)).
+		Set("failed_attempts = failed_attempts + 1").
+		Where("id = ?", id).
+		Returning("failed_attempts").
+		Scan(ctx, &n)
+	return n, err
+}
+
+func (r sessionRepo) Revoke(ctx context.Context, userID, id string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*Session)(nil)).
+			Where("id = ?", id).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return insertAudit(ctx, tx, SessionAuditRecord(AuditSessionRevoke, id))
+	})
+}
+
+func (r sessionRepo) RevokeAll(ctx context.Context, userID, except string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*Session)(nil)).
+			Where("user_id = ?", userID).
+			Where("id != ?", except).
+			Exec(ctx); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, SessionAuditRecord(AuditSessionRevokeAll, userID))
+	})
+}
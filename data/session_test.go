@@ -0,0 +1,28 @@
+package data
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealToken(t *testing.T) {
+	if err := SetSessionKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealToken("a", "refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == "refresh" {
+		t.Fatal("token stored in plain text")
+	}
+	if token, err := openToken("a", sealed); err != nil || token != "refresh" {
+		t.Errorf("openToken = %q, %v, want refresh", token, err)
+	}
+	if _, err := openToken("b", sealed); err == nil {
+		t.Error("token of session a opened for session b")
+	}
+	if token, err := openToken("a", "legacy"); err != nil || token != "legacy" {
+		t.Errorf("openToken of a plain token = %q, %v", token, err)
+	}
+}
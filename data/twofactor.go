@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ErrTwoFactorEnabled is returned when enrolling a user whose second
+// factor is already enabled.
+var ErrTwoFactorEnabled = errors.New("data: two-factor authentication is already enabled")
+
+// RecoveryCodeCount is how many recovery codes a user gets when enabling
+// two-factor authentication.
+const RecoveryCodeCount = 10
+
+// TwoFactor is the TOTP second factor of a user. It is pending until the
+// user confirms it with a first code.
+type TwoFactor struct {
+	UserID    string `bun:",pk"`
+	Secret    string
+	EnabledAt *time.Time
+	// LastStep is the time step of the last accepted code, so a code
+	// can't be used twice.
+	LastStep  int64
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Enabled reports whether codes are asked for at login.
+func (t *TwoFactor) Enabled() bool {
+	return t != nil && t.EnabledAt != nil
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code, for users who
+// lost their authenticator. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID     string `bun:",pk"`
+	UserID string
+	UsedAt *time.Time
+}
+
+// NewRecoveryCodes returns RecoveryCodeCount new codes.
+func NewRecoveryCodes() []string {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		c := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+	}
+	return codes
+}
+
+// RecoveryCodeID returns the id of a recovery code as the user typed it.
+func RecoveryCodeID(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
+
+// TwoFactorAuditRecord describes a change to the second factor of a user.
+func TwoFactorAuditRecord(action, userID string) AuditRecord {
+	return AuditRecord{Action: action, TargetType: "user", TargetID: userID}
+}
+
+type twoFactorRepo struct {
+	db bun.IDB
+}
+
+func (r twoFactorRepo) Get(ctx context.Context, userID string) (*TwoFactor, error) {
+	tf := new(TwoFactor)
+	err := r.db.NewSelect().Model(tf).Where("user_id = ?", userID).Scan(ctx)
+	return tf, err
+}
+
+func (r twoFactorRepo) Begin(ctx context.Context, tf *TwoFactor) error {
+	res, err := r.db.NewInsert().Model(tf).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("secret = EXCLUDED.secret").
+		Set("created_at = EXCLUDED.created_at").
+		Where("two_factor.enabled_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (r twoFactorRepo) Enable(ctx context.Context, userID string, step int64, codes []string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().Model((*TwoFactor)(nil)).
+			Set("enabled_at = ?", time.Now()).
+			Set("last_step = ?", step).
+			Where("user_id = ?", userID).
+			Where("enabled_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrTwoFactorEnabled
+		}
+		if err := replaceRecoveryCodes(ctx, tx, userID, codes); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, TwoFactorAuditRecord(AuditTwoFactorEnable, userID))
+	})
+}
+
+func (r twoFactorRepo) Disable(ctx context.Context, userID string) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*TwoFactor)(nil)).Where("user_id = ?", userID).Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, TwoFactorAuditRecord(AuditTwoFactorDisable, userID))
+	})
+}
+
+func (r twoFactorRepo) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := r.db.NewUpdate().Model((*TwoFactor)(nil)).
+		Set("last_step = ?", step).
+		Where("user_id = ?", userID).
+		Where("last_step < ?", step).
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r twoFactorRepo) UseRecoveryCode(ctx context.Context, userID, code string) error {
+	res, err := r.db.NewUpdate().Model((*RecoveryCode)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("id = ?", RecoveryCodeID(code)).
+		Where("user_id = ?", userID).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r twoFactorRepo) RecoveryCodesLeft(ctx context.Context, userID string) (int, error) {
+	return r.db.NewSelect().Model((*RecoveryCode)(nil)).
+		Where("user_id = ?", userID).
+		Where("used_at IS NULL").
+		Count(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx bun.Tx, userID string, codes []string) error {
+	if _, err := tx.NewDelete().Model((*RecoveryCode)(nil)).Where("user_id = ?", userID).Exec(ctx); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	rows := make([]RecoveryCode, len(codes))
+	for i, c := range codes {
+		rows[i] = RecoveryCode{ID: RecoveryCodeID(c), UserID: userID}
+	}
+	_, err := tx.NewInsert().Model(&rows).Exec(ctx)
+	return err
+}
@@ -12,18 +12,22 @@ type User struct {
 	Name         string `bun:",notnull"`
 	Email        string `bun:",notnull"`
 	PasswordHash string `bun:",notnull"`
-	AccessLevel  int
+	AccessLevel  Role
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	DeletedAt    *time.Time
 	Preferences  map[string]string
 
 	EmailVerifiedAt sql.NullTime
+	// VerificationSentAt is when the last verification mail was sent.
+	VerificationSentAt sql.NullTime
 }
 
 const (
 	UserSignupEvent         = "auth.signup"
 	ResendVerificationEvent = "auth.resend.verification"
+	PasswordResetEvent      = "auth.password.reset"
+	AccountCreatedEvent     = "account.created"
 )
 
 type UserWithVerificationToken struct {
@@ -35,11 +39,32 @@ type UserWithSignup struct {
 	User *supabase.User
 }
 
+// VerificationRequested is published with ResendVerificationEvent to mail a
+// verification link.
+type VerificationRequested struct {
+	Email     string
+	Name      string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// PasswordResetRequested is published with PasswordResetEvent to mail a
+// password reset link.
+type PasswordResetRequested struct {
+	Email     string
+	Name      string
+	URL       string
+	ExpiresAt time.Time
+}
+
 type AuthenticatedUser struct {
 	ID       string
 	Name     string
 	Email    string
 	LoggedIn bool
+	// AccessLevel is the role of the user in the account the request is
+	// scoped to.
+	AccessLevel Role
 }
 
 type Preferences struct {
@@ -52,6 +77,7 @@ type Preferences struct {
 
 type Host struct {
 	ID            int    `bun:",pk,autoincrement"`
+	AccountID     int64  `bun:",nullzero"`
 	HostName      string `bun:",notnull"`
 	CanonicalName string `bun:",notnull"`
 	URL           *string
@@ -60,9 +86,10 @@ type Host struct {
 	Location      *string
 	OS            *string
 	Active        int
+	Tags          []string `bun:",array"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	HostServices  []HostService
+	HostServices  []HostService `bun:"rel:has-many,join:id=host_id"`
 }
 
 type Services struct {
@@ -84,8 +111,8 @@ type HostService struct {
 	Status         string
 	LastCheck      time.Time
 	LastMessage    string
-	Service        Services
-	HostName       string
+	Service        Services `bun:"rel:belongs-to,join:service_id=id"`
+	HostName       string   `bun:",scanonly"`
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
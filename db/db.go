@@ -5,10 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
+	"github.com/NikoMalik/GoTrack/config"
 	_ "github.com/lib/pq"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
@@ -22,13 +21,12 @@ const maxRetries = 5
 const retryDelay = 2 * time.Second
 
 // Init initializes the PostgreSQL connection using Bun and pgdriver
-func Init() {
+func Init(cfg config.DB) {
 	var err error
 
 	for i := 0; i < maxRetries; i++ {
 		// Construct the database URI in the correct format
-		connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s",
-			os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+		connStr := cfg.DSN()
 
 		// Initialize the SQL database
 		sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(connStr)))
@@ -65,11 +63,3 @@ func checkConnection(db *bun.DB) error {
 	fmt.Println("Successfully connected to the database")
 	return nil
 }
-
-// WhereMap adds where clauses to the query builder based on the provided map
-func WhereMap(qb bun.QueryBuilder, m fiber.Map) bun.QueryBuilder {
-	for k, v := range m {
-		qb = qb.Where(fmt.Sprintf("%s = ?", k), v)
-	}
-	return qb
-}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/db/migrations"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// newProvider returns a goose provider for the embedded migrations. It holds
+// a Postgres advisory lock while migrating, so replicas that start at the
+// same time migrate one after another.
+func newProvider() (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, Bun.DB, migrations.FS,
+		goose.WithSessionLocker(locker),
+	)
+}
+
+// Migrate runs the migration command, which is one of "up", "down",
+// "redo" or "status", and writes what it did to w.
+func Migrate(ctx context.Context, command string, w io.Writer) error {
+	p, err := newProvider()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := p.Up(ctx)
+		printResults(w, results...)
+		if len(results) == 0 && err == nil {
+			fmt.Fprintln(w, "no migrations to run")
+		}
+		return err
+	case "down":
+		res, err := p.Down(ctx)
+		printResults(w, res)
+		return err
+	case "redo":
+		res, err := p.Down(ctx)
+		printResults(w, res)
+		if err != nil {
+			return err
+		}
+		res, err = p.UpByOne(ctx)
+		printResults(w, res)
+		return err
+	case "status":
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.State == goose.StateApplied {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", applied, s.Source.Path)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+func printResults(w io.Writer, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		fmt.Fprintln(w, r)
+	}
+}
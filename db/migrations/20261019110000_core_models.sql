@@ -0,0 +1,153 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The users migration is a placeholder, so the table is created here.
+-- Databases where it was made by hand get the columns they miss.
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password_hash TEXT NOT NULL DEFAULT '',
+    access_level INTEGER NOT NULL DEFAULT 0,
+    preferences JSONB,
+    email_verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMPTZ
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS access_level INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS preferences JSONB,
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email)) WHERE deleted_at IS NULL;
+
+-- user_id is the Supabase user id, which has no row in users for
+-- accounts created through Supabase auth, so there is no foreign key.
+CREATE TABLE IF NOT EXISTS accounts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    stripe_customer_id TEXT NOT NULL DEFAULT '',
+    stripe_subscription_id TEXT NOT NULL DEFAULT '',
+    subscription_status TEXT NOT NULL DEFAULT '',
+    plan INTEGER NOT NULL DEFAULT 0,
+    notify_upfront INTEGER NOT NULL DEFAULT 7,
+    notify_default_email TEXT NOT NULL DEFAULT '',
+    notify_webhook_url TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+CREATE INDEX IF NOT EXISTS accounts_stripe_customer_id_idx ON accounts (stripe_customer_id)
+    WHERE stripe_customer_id <> '';
+
+CREATE TABLE IF NOT EXISTS preferences (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    preference BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS preferences_name_idx ON preferences (name);
+
+CREATE TABLE IF NOT EXISTS hosts (
+    id SERIAL PRIMARY KEY,
+    host_name TEXT NOT NULL,
+    canonical_name TEXT NOT NULL,
+    url TEXT,
+    ip TEXT,
+    ipv6 TEXT,
+    location TEXT,
+    os TEXT,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS hosts_host_name_idx ON hosts (host_name);
+CREATE INDEX IF NOT EXISTS hosts_created_at_idx ON hosts (created_at);
+
+CREATE TABLE IF NOT EXISTS services (
+    id SERIAL PRIMARY KEY,
+    service_name TEXT NOT NULL,
+    active INTEGER NOT NULL DEFAULT 1,
+    icon TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS services_service_name_idx ON services (service_name);
+
+CREATE TABLE IF NOT EXISTS host_services (
+    id SERIAL PRIMARY KEY,
+    host_id INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+    service_id INTEGER NOT NULL REFERENCES services (id) ON DELETE RESTRICT,
+    active INTEGER NOT NULL DEFAULT 1,
+    schedule_number INTEGER NOT NULL DEFAULT 3,
+    schedule_unit TEXT NOT NULL DEFAULT 'm',
+    status TEXT NOT NULL DEFAULT 'pending',
+    last_check TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+    last_message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host_id, service_id)
+);
+
+CREATE INDEX IF NOT EXISTS host_services_host_id_idx ON host_services (host_id);
+CREATE INDEX IF NOT EXISTS host_services_service_id_idx ON host_services (service_id);
+CREATE INDEX IF NOT EXISTS host_services_status_idx ON host_services (status);
+
+CREATE TABLE IF NOT EXISTS schedules (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL,
+    entry TIMESTAMPTZ NOT NULL,
+    host TEXT NOT NULL,
+    service TEXT NOT NULL,
+    last_run_from_hs TIMESTAMPTZ,
+    host_service_id INTEGER NOT NULL REFERENCES host_services (id) ON DELETE CASCADE,
+    schedule_text TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS schedules_host_service_id_idx ON schedules (host_service_id);
+
+CREATE TABLE IF NOT EXISTS events (
+    id SERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    host_service_id INTEGER NOT NULL REFERENCES host_services (id) ON DELETE CASCADE,
+    host_id INTEGER NOT NULL REFERENCES hosts (id) ON DELETE CASCADE,
+    service_name TEXT NOT NULL DEFAULT '',
+    host_name TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS events_host_id_idx ON events (host_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS events_host_service_id_idx ON events (host_service_id);
+CREATE INDEX IF NOT EXISTS events_created_at_idx ON events (created_at);
+
+-- Built-in service types.
+INSERT INTO services (service_name, icon) VALUES
+    ('HTTP', 'world'),
+    ('HTTPS', 'lock'),
+    ('SSL Certificate', 'certificate'),
+    ('Ping', 'signal'),
+    ('DNS', 'server')
+ON CONFLICT (service_name) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS schedules;
+DROP TABLE IF EXISTS host_services;
+DROP TABLE IF EXISTS services;
+DROP TABLE IF EXISTS hosts;
+DROP TABLE IF EXISTS preferences;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS hosts_tags_idx ON hosts USING GIN (tags);
+CREATE INDEX IF NOT EXISTS host_services_last_check_idx ON host_services (last_check);
+CREATE INDEX IF NOT EXISTS events_event_type_idx ON events (event_type, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS events_event_type_idx;
+DROP INDEX IF EXISTS host_services_last_check_idx;
+DROP INDEX IF EXISTS hosts_tags_idx;
+ALTER TABLE hosts DROP COLUMN IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An account is an organization. user_id stays the user that created it,
+-- who may now own several accounts and be a member of others.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS accounts_user_id_idx;
+CREATE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    account_id BIGINT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT 'member',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships (user_id);
+
+INSERT INTO memberships (account_id, user_id, email, role)
+SELECT id, user_id, notify_default_email, 'owner' FROM accounts
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    invited_by TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS invitations_pending_idx ON invitations (account_id, lower(email))
+    WHERE accepted_at IS NULL;
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON invitations (lower(email)) WHERE accepted_at IS NULL;
+
+-- Hosts without an account are visible to nobody, so existing hosts go to
+-- the oldest account.
+ALTER TABLE hosts ADD COLUMN IF NOT EXISTS account_id BIGINT REFERENCES accounts (id) ON DELETE CASCADE;
+UPDATE hosts SET account_id = (SELECT min(id) FROM accounts) WHERE account_id IS NULL;
+CREATE INDEX IF NOT EXISTS hosts_account_id_idx ON hosts (account_id, host_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS hosts_account_id_idx;
+ALTER TABLE hosts DROP COLUMN IF EXISTS account_id;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS memberships;
+DROP INDEX IF EXISTS accounts_user_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts (user_id);
+ALTER TABLE accounts DROP COLUMN IF EXISTS name;
+-- +goose StatementEnd
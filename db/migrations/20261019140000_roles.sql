@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles are stored as access levels, from viewer (0) to owner (4), the same
+-- scale as users.access_level. Existing members become editors.
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS access_level INTEGER NOT NULL DEFAULT 0;
+UPDATE memberships SET access_level = CASE role WHEN 'owner' THEN 4 ELSE 2 END;
+ALTER TABLE memberships DROP COLUMN IF EXISTS role;
+
+ALTER TABLE invitations ADD COLUMN IF NOT EXISTS access_level INTEGER NOT NULL DEFAULT 0;
+UPDATE invitations SET access_level = CASE role WHEN 'owner' THEN 4 ELSE 2 END;
+ALTER TABLE invitations DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE invitations ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';
+UPDATE invitations SET role = CASE WHEN access_level = 4 THEN 'owner' ELSE 'member' END;
+ALTER TABLE invitations DROP COLUMN IF EXISTS access_level;
+
+ALTER TABLE memberships ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';
+UPDATE memberships SET role = CASE WHEN access_level = 4 THEN 'owner' ELSE 'member' END;
+ALTER TABLE memberships DROP COLUMN IF EXISTS access_level;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Limits how often verification mails can be resent to a user.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS verification_sent_at;
+-- +goose StatementEnd
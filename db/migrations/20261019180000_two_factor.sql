@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The TOTP secret of a user, pending until enabled_at is set.
+CREATE TABLE IF NOT EXISTS two_factors (
+    user_id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Recovery codes are stored hashed, like session tokens.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- A pending session passed the password but not yet the second factor.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS pending BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS require_2fa BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE accounts DROP COLUMN IF EXISTS require_2fa;
+ALTER TABLE sessions DROP COLUMN IF EXISTS pending;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS two_factors;
+-- +goose StatementEnd
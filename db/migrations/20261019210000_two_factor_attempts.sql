@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Counts the wrong codes entered for a pending session, which ends after
+-- too many.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN IF EXISTS failed_attempts;
+-- +goose StatementEnd
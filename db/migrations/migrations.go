@@ -0,0 +1,9 @@
+// Package migrations embeds the goose migrations of the database schema.
+package migrations
+
+import "embed"
+
+// FS holds every migration file.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+)
+
+// ErrSchemaOutdated is returned by CheckSchema when migrations are pending.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// CheckSchema returns ErrSchemaOutdated if any embedded migration has not
+// been applied to the database.
+func CheckSchema(ctx context.Context) error {
+	p, err := newProvider()
+	if err != nil {
+		return err
+	}
+	statuses, err := p.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("check schema: %w", err)
+	}
+	var pending []int64
+	for _, s := range statuses {
+		if s.State == goose.StatePending {
+			pending = append(pending, s.Source.Version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s), first is %d; run `gotrack migrate up`",
+			ErrSchemaOutdated, len(pending), pending[0])
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package db
+
+import "context"
+
+// Seed inserts the built-in service types and, if there are no hosts yet,
+// a demo host to try the monitoring with. The host belongs to the oldest
+// account. It is safe to run repeatedly.
+func Seed(ctx context.Context) error {
+	_, err := Bun.ExecContext(ctx, `
+		INSERT INTO services (service_name, icon) VALUES
+			('HTTP', 'world'),
+			('HTTPS', 'lock'),
+			('SSL Certificate', 'certificate'),
+			('Ping', 'signal'),
+			('DNS', 'server')
+		ON CONFLICT (service_name) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+
+	_, err = Bun.ExecContext(ctx, `
+		WITH host AS (
+			INSERT INTO hosts (account_id, host_name, canonical_name, url)
+			SELECT (SELECT min(id) FROM accounts), 'example.com', 'Example', 'https://example.com'
+			WHERE NOT EXISTS (SELECT 1 FROM hosts)
+			RETURNING id
+		)
+		INSERT INTO host_services (host_id, service_id)
+		SELECT host.id, s.id FROM host, services AS s
+		WHERE s.service_name IN ('HTTPS', 'SSL Certificate')`)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,8 +29,26 @@ func Unsubscribe(sub Subscription) {
 }
 
 // Stop stops the event stream, cleaning up its resources.
+// It waits for queued events and in-flight handlers to finish.
 func Stop() {
-	stream.stop()
+	stream.drain(context.Background())
+}
+
+// Drain stops accepting new events, delivers the events already queued and
+// waits for in-flight handlers until ctx is done. It returns the number of
+// events and handler invocations that were dropped.
+func Drain(ctx context.Context) (int, error) {
+	return stream.drain(ctx)
+}
+
+// Len returns the number of events waiting in the queue.
+func Len() int {
+	return len(stream.eventch)
+}
+
+// Cap returns the capacity of the event queue.
+func Cap() int {
+	return cap(stream.eventch)
 }
 
 var stream *eventStream
@@ -51,6 +70,15 @@ type eventStream struct {
 	subs    map[string][]Subscription
 	eventch chan event
 	quitch  chan struct{}
+	donech  chan struct{}
+
+	// closeMu guards closed. It is separate from mu so a blocked emit
+	// never stops the dispatch loop from reading subscriptions.
+	closeMu  sync.RWMutex
+	closed   bool
+	dropped  atomic.Int64
+	inflight atomic.Int64
+	wg       sync.WaitGroup
 }
 
 func newStream() *eventStream {
@@ -58,32 +86,91 @@ func newStream() *eventStream {
 		subs:    make(map[string][]Subscription),
 		eventch: make(chan event, 128),
 		quitch:  make(chan struct{}),
+		donech:  make(chan struct{}),
 	}
 	go e.start()
 	return e
 }
 
 func (e *eventStream) start() {
-	ctx := context.Background()
+	defer close(e.donech)
 	for {
 		select {
 		case <-e.quitch:
-			return
-		case evt := <-e.eventch:
-			if handlers, ok := e.subs[evt.topic]; ok {
-				for _, sub := range handlers {
-					go sub.Fn(ctx, evt.message)
+			// Deliver whatever was queued before the stream was closed.
+			for {
+				select {
+				case evt := <-e.eventch:
+					e.dispatch(evt)
+				default:
+					return
 				}
 			}
+		case evt := <-e.eventch:
+			e.dispatch(evt)
 		}
 	}
 }
 
-func (e *eventStream) stop() {
-	e.quitch <- struct{}{}
+func (e *eventStream) dispatch(evt event) {
+	ctx := context.Background()
+
+	e.mu.RLock()
+	handlers := e.subs[evt.topic]
+	e.mu.RUnlock()
+
+	for _, sub := range handlers {
+		e.wg.Add(1)
+		e.inflight.Add(1)
+		go func(fn HandlerFunc) {
+			defer e.wg.Done()
+			defer e.inflight.Add(-1)
+			fn(ctx, evt.message)
+		}(sub.Fn)
+	}
+}
+
+func (e *eventStream) drain(ctx context.Context) (int, error) {
+	e.closeMu.Lock()
+	if e.closed {
+		e.closeMu.Unlock()
+		return 0, nil
+	}
+	e.closed = true
+	e.closeMu.Unlock()
+
+	close(e.quitch)
+
+	select {
+	case <-e.donech:
+	case <-ctx.Done():
+		return int(e.dropped.Load()) + len(e.eventch) + int(e.inflight.Load()), ctx.Err()
+	}
+
+	waitch := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(waitch)
+	}()
+
+	select {
+	case <-waitch:
+		return int(e.dropped.Load()), nil
+	case <-ctx.Done():
+		return int(e.dropped.Load()) + int(e.inflight.Load()), ctx.Err()
+	}
 }
 
 func (e *eventStream) emit(topic string, v any) {
+	e.closeMu.RLock()
+	defer e.closeMu.RUnlock()
+
+	// Intake is stopped once the stream is drained.
+	if e.closed {
+		e.dropped.Add(1)
+		return
+	}
+
 	e.eventch <- event{
 		topic:   topic,
 		message: v,
@@ -91,8 +178,8 @@ func (e *eventStream) emit(topic string, v any) {
 }
 
 func (e *eventStream) subscribe(topic string, h HandlerFunc) Subscription {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
 	sub := Subscription{
 		CreatedAt: time.Now().UnixNano(),
@@ -110,8 +197,8 @@ func (e *eventStream) subscribe(topic string, h HandlerFunc) Subscription {
 }
 
 func (e *eventStream) unsubscribe(sub Subscription) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
 	if _, ok := e.subs[sub.Topic]; ok {
 		e.subs[sub.Topic] = slices.DeleteFunc(e.subs[sub.Topic], func(e Subscription) bool {
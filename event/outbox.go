@@ -0,0 +1,496 @@
+package event
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/uptrace/bun"
+)
+
+// AckHandlerFunc is the function being called when the relay delivers a
+// persisted event. Returning nil acknowledges the event, returning an error
+// schedules it for another attempt.
+type AckHandlerFunc func(context.Context, *Envelope) error
+
+// Envelope wraps an event read back from the outbox.
+type Envelope struct {
+	ID        int64
+	Topic     string
+	Payload   json.RawMessage
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Decode unmarshals the payload of the envelope into v.
+func (e *Envelope) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// OutboxEvent is an event persisted together with the data change that caused it.
+type OutboxEvent struct {
+	bun.BaseModel `bun:"table:event_outbox"`
+
+	ID          int64           `bun:",pk,autoincrement"`
+	Topic       string          `bun:",notnull"`
+	Payload     json.RawMessage `bun:"type:jsonb,notnull"`
+	Attempts    int             `bun:",notnull"`
+	LastError   string
+	AvailableAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+	DeliveredAt bun.NullTime
+	CreatedAt   time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// DeadLetter is an event that could not be delivered after MaxAttempts.
+type DeadLetter struct {
+	bun.BaseModel `bun:"table:event_dead_letters"`
+
+	ID        int64           `bun:",pk,autoincrement"`
+	EventID   int64           `bun:",notnull"`
+	Topic     string          `bun:",notnull"`
+	Payload   json.RawMessage `bun:"type:jsonb,notnull"`
+	Attempts  int             `bun:",notnull"`
+	LastError string
+	CreatedAt time.Time `bun:",notnull"`
+	FailedAt  time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// RelayConfig configures the outbox relay.
+type RelayConfig struct {
+	// PollInterval is how often the relay looks for pending events.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of events claimed per poll.
+	BatchSize int
+	// MaxAttempts is the number of failed deliveries after which an
+	// event is moved to the dead-letter table.
+	MaxAttempts int
+	// RetryBackoff is the base delay between attempts, doubled every retry.
+	RetryBackoff time.Duration
+	// HandlerTimeout bounds a single delivery to a subscriber.
+	HandlerTimeout time.Duration
+	// Lease is how long a claimed batch is reserved for the relay that
+	// claimed it. Events not delivered within it are left to the next poll.
+	Lease time.Duration
+	// Retention is how long events that were delivered, or that have no
+	// durable subscriber, are kept after they were created. It bounds how
+	// far back Replay reaches.
+	Retention time.Duration
+	// PruneInterval is how often events past Retention are deleted.
+	PruneInterval time.Duration
+}
+
+// DefaultRelayConfig is used for every zero field of the config passed to StartRelay.
+var DefaultRelayConfig = RelayConfig{
+	PollInterval:   time.Second,
+	BatchSize:      50,
+	MaxAttempts:    10,
+	RetryBackoff:   5 * time.Second,
+	HandlerTimeout: 30 * time.Second,
+	Lease:          5 * time.Minute,
+	Retention:      7 * 24 * time.Hour,
+	PruneInterval:  time.Hour,
+}
+
+// ErrOutboxDisabled is returned by the outbox API when no relay is running.
+var ErrOutboxDisabled = errors.New("event outbox is not enabled")
+
+var outbox *relay
+
+// StartRelay enables the Postgres-backed outbox and starts relaying persisted
+// events to durable subscribers.
+func StartRelay(db *bun.DB, cfg RelayConfig) {
+	outbox = newRelay(db, cfg)
+	go outbox.start()
+}
+
+// StopRelay stops the outbox relay and waits for the batch in flight until
+// ctx is done. Events that are not delivered yet stay in the outbox and are
+// picked up on the next start.
+func StopRelay(ctx context.Context) error {
+	if outbox == nil {
+		return nil
+	}
+	return outbox.stop(ctx)
+}
+
+// EmitTx persists the event in the outbox using the given transaction, so it
+// is only delivered when the surrounding data change is committed.
+// When the outbox is not enabled, or the topic has no durable subscriber
+// to deliver to, the event is emitted in-memory instead.
+func EmitTx(ctx context.Context, tx bun.IDB, topic string, v any) error {
+	if outbox == nil || !durable.has(topic) {
+		Emit(topic, v)
+		return nil
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("event: marshal %s: %w", topic, err)
+	}
+
+	_, err = tx.NewInsert().Model(&OutboxEvent{
+		Topic:   topic,
+		Payload: payload,
+	}).Exec(ctx)
+	return err
+}
+
+// SubscribeDurable subscribes an AckHandlerFunc to the given topic of the outbox.
+// Delivery is at-least-once: an event is retried until every durable
+// subscriber of its topic acknowledged it, so handlers must be idempotent.
+func SubscribeDurable(topic string, h AckHandlerFunc) Subscription {
+	return durable.subscribe(topic, h)
+}
+
+// UnsubscribeDurable removes the given durable Subscription.
+func UnsubscribeDurable(sub Subscription) {
+	durable.unsubscribe(sub)
+}
+
+// Replay re-delivers every outbox event created at or after since that is
+// still in the outbox, see RelayConfig.Retention.
+// If topics are given only those topics are replayed.
+// It returns the number of events queued for delivery.
+func Replay(ctx context.Context, since time.Time, topics ...string) (int, error) {
+	if outbox == nil {
+		return 0, ErrOutboxDisabled
+	}
+
+	q := outbox.db.NewUpdate().Model((*OutboxEvent)(nil)).
+		Set("delivered_at = NULL").
+		Set("attempts = 0").
+		Set("last_error = ''").
+		Set("available_at = current_timestamp").
+		Where("created_at >= ?", since)
+	if len(topics) > 0 {
+		q = q.Where("topic IN (?)", bun.In(topics))
+	}
+
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// DeadLetters returns the dead-lettered events, newest first.
+func DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	if outbox == nil {
+		return nil, ErrOutboxDisabled
+	}
+
+	var letters []DeadLetter
+	err := outbox.db.NewSelect().Model(&letters).
+		OrderExpr("id DESC").
+		Limit(limit).
+		Scan(ctx)
+	return letters, err
+}
+
+// durableSubs holds the handlers the relay delivers to.
+type durableSubs struct {
+	mu   sync.RWMutex
+	subs map[string][]durableSub
+}
+
+type durableSub struct {
+	Subscription
+	fn AckHandlerFunc
+}
+
+var durable = &durableSubs{subs: make(map[string][]durableSub)}
+
+func (d *durableSubs) subscribe(topic string, h AckHandlerFunc) Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub := Subscription{
+		CreatedAt: time.Now().UnixNano(),
+		Topic:     topic,
+	}
+	d.subs[topic] = append(d.subs[topic], durableSub{Subscription: sub, fn: h})
+	return sub
+}
+
+func (d *durableSubs) unsubscribe(sub Subscription) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	subs := d.subs[sub.Topic]
+	for i, s := range subs {
+		if s.CreatedAt == sub.CreatedAt {
+			d.subs[sub.Topic] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(d.subs[sub.Topic]) == 0 {
+		delete(d.subs, sub.Topic)
+	}
+}
+
+func (d *durableSubs) has(topic string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.subs[topic]) > 0
+}
+
+func (d *durableSubs) topics() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	topics := make([]string, 0, len(d.subs))
+	for topic := range d.subs {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+func (d *durableSubs) handlers(topic string) []AckHandlerFunc {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	fns := make([]AckHandlerFunc, 0, len(d.subs[topic]))
+	for _, s := range d.subs[topic] {
+		fns = append(fns, s.fn)
+	}
+	return fns
+}
+
+type relay struct {
+	db     *bun.DB
+	cfg    RelayConfig
+	quitch chan struct{}
+	donech chan struct{}
+}
+
+func newRelay(db *bun.DB, cfg RelayConfig) *relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultRelayConfig.PollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultRelayConfig.BatchSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultRelayConfig.MaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRelayConfig.RetryBackoff
+	}
+	if cfg.HandlerTimeout <= 0 {
+		cfg.HandlerTimeout = DefaultRelayConfig.HandlerTimeout
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultRelayConfig.Lease
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRelayConfig.Retention
+	}
+	if cfg.PruneInterval <= 0 {
+		cfg.PruneInterval = DefaultRelayConfig.PruneInterval
+	}
+	return &relay{
+		db:     db,
+		cfg:    cfg,
+		quitch: make(chan struct{}),
+		donech: make(chan struct{}),
+	}
+}
+
+func (r *relay) start() {
+	defer close(r.donech)
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(r.cfg.PruneInterval)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-r.quitch:
+			return
+		case <-pruneTicker.C:
+			if n, err := r.prune(context.Background()); err != nil {
+				logEvent.Error("event outbox prune", "error", err)
+			} else if n > 0 {
+				logEvent.Info("event outbox pruned", "events", n)
+			}
+		case <-ticker.C:
+			// Keep draining while full batches come back.
+			for {
+				n, err := r.poll(context.Background())
+				if err != nil {
+					logEvent.Error("event outbox poll", "error", err)
+				}
+				if err != nil || n < r.cfg.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (r *relay) stop(ctx context.Context) error {
+	close(r.quitch)
+	select {
+	case <-r.donech:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prune deletes the events older than Retention that were delivered, or
+// that no durable subscriber is left to deliver them to.
+func (r *relay) prune(ctx context.Context) (int64, error) {
+	q := r.db.NewDelete().Model((*OutboxEvent)(nil)).
+		Where("created_at < ?", time.Now().Add(-r.cfg.Retention))
+	if topics := durable.topics(); len(topics) > 0 {
+		q = q.Where("delivered_at IS NOT NULL OR topic NOT IN (?)", bun.In(topics))
+	}
+	res, err := q.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// poll claims a batch of pending events and delivers them.
+func (r *relay) poll(ctx context.Context) (int, error) {
+	topics := durable.topics()
+	if len(topics) == 0 {
+		return 0, nil
+	}
+
+	events, err := r.claim(ctx, topics)
+	if err != nil {
+		return 0, err
+	}
+	for i := range events {
+		// Past the lease another relay may have claimed the rest.
+		if time.Now().After(events[i].AvailableAt) {
+			return i, nil
+		}
+		if err := r.deliver(ctx, &events[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// claim leases a batch of pending events by moving their available_at past
+// the lease. Rows are only locked, with SKIP LOCKED, for the claim itself,
+// so several replicas can relay the same outbox and no lock is held while
+// handlers run.
+func (r *relay) claim(ctx context.Context, topics []string) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := r.claimQuery(topics, time.Now()).Scan(ctx, &events)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	slices.SortFunc(events, func(a, b OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+	return events, err
+}
+
+// claimQuery returns the statement that leases the next batch of pending
+// events of topics at now.
+func (r *relay) claimQuery(topics []string, now time.Time) *bun.UpdateQuery {
+	pending := r.db.NewSelect().Model((*OutboxEvent)(nil)).
+		Column("id").
+		Where("delivered_at IS NULL").
+		Where("available_at <= current_timestamp").
+		Where("topic IN (?)", bun.In(topics)).
+		OrderExpr("id ASC").
+		Limit(r.cfg.BatchSize).
+		For("UPDATE SKIP LOCKED")
+
+	return r.db.NewUpdate().Model((*OutboxEvent)(nil)).
+		Set("available_at = ?", now.Add(r.cfg.Lease)).
+		Where("id IN (?)", pending).
+		Returning("*")
+}
+
+// deliver dispatches a single event and records the outcome.
+func (r *relay) deliver(ctx context.Context, evt *OutboxEvent) error {
+	env := &Envelope{
+		ID:        evt.ID,
+		Topic:     evt.Topic,
+		Payload:   evt.Payload,
+		Attempts:  evt.Attempts,
+		CreatedAt: evt.CreatedAt,
+	}
+
+	var errs []error
+	for _, fn := range durable.handlers(evt.Topic) {
+		if err := r.call(ctx, fn, env); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		_, err := r.db.NewUpdate().Model(evt).
+			Set("delivered_at = current_timestamp").
+			WherePK().
+			Exec(ctx)
+		return err
+	}
+
+	evt.Attempts++
+	evt.LastError = errors.Join(errs...).Error()
+
+	if evt.Attempts >= r.cfg.MaxAttempts {
+		logEvent.Error("event dead-lettered", "id", evt.ID, "topic", evt.Topic, "error", evt.LastError)
+		return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			_, err := tx.NewInsert().Model(&DeadLetter{
+				EventID:   evt.ID,
+				Topic:     evt.Topic,
+				Payload:   evt.Payload,
+				Attempts:  evt.Attempts,
+				LastError: evt.LastError,
+				CreatedAt: evt.CreatedAt,
+			}).Exec(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = tx.NewDelete().Model(evt).WherePK().Exec(ctx)
+			return err
+		})
+	}
+
+	evt.AvailableAt = time.Now().Add(r.backoff(evt.Attempts))
+	_, err := r.db.NewUpdate().Model(evt).
+		Column("attempts", "last_error", "available_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+// call runs a handler with a timeout, turning a panic into an error.
+func (r *relay) call(ctx context.Context, fn AckHandlerFunc, env *Envelope) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.HandlerTimeout)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("handler panic: %v", rec)
+		}
+	}()
+	return fn(ctx, env)
+}
+
+// backoff returns the delay before the given attempt, capped at one hour.
+func (r *relay) backoff(attempt int) time.Duration {
+	d := r.cfg.RetryBackoff
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
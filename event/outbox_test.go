@@ -0,0 +1,344 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestBackoff(t *testing.T) {
+	r := newRelay(nil, RelayConfig{RetryBackoff: time.Second})
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 20: time.Hour} {
+		if got := r.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestEmitTxWithoutDurableSubscriber(t *testing.T) {
+	prev := outbox
+	outbox = newRelay(nil, RelayConfig{})
+	defer func() { outbox = prev }()
+
+	got := make(chan any, 1)
+	sub := Subscribe("test.memory", func(ctx context.Context, v any) { got <- v })
+	defer Unsubscribe(sub)
+
+	// Nothing would deliver the event from the outbox, so it isn't stored.
+	if err := EmitTx(context.Background(), nil, "test.memory", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-got:
+		if v != "hello" {
+			t.Errorf("got %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not emitted in memory")
+	}
+}
+
+func TestClaimQuery(t *testing.T) {
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+	r := newRelay(db, RelayConfig{BatchSize: 10})
+	q := r.claimQuery([]string{"a"}, time.Now()).String()
+	for _, want := range []string{"FOR UPDATE SKIP LOCKED", "delivered_at IS NULL", "LIMIT 10", "RETURNING *"} {
+		if !strings.Contains(q, want) {
+			t.Errorf("claim query %q lacks %q", q, want)
+		}
+	}
+}
+
+// The tests below need a Postgres database, given as TEST_DATABASE_URL.
+// Each runs in a schema of its own that is dropped afterwards.
+
+// testRelay returns a relay on an empty outbox and enables the outbox with
+// it. The relay isn't started, tests poll it themselves.
+func testRelay(t *testing.T, cfg RelayConfig) *relay {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	admin := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("outbox_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE") })
+
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(
+		pgdriver.WithDSN(dsn),
+		pgdriver.WithConnParams(map[string]any{"search_path": schema}),
+	)), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+	migration, err := os.ReadFile("../db/migrations/20261019090000_event_outbox.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+	if _, err := db.ExecContext(ctx, up); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRelay(db, cfg)
+	prev := outbox
+	outbox = r
+	t.Cleanup(func() { outbox = prev })
+	return r
+}
+
+// subscribe subscribes h durably to topic for the rest of the test.
+func subscribe(t *testing.T, topic string, h AckHandlerFunc) {
+	sub := SubscribeDurable(topic, h)
+	t.Cleanup(func() { UnsubscribeDurable(sub) })
+}
+
+func emit(t *testing.T, r *relay, topic string, v any) {
+	t.Helper()
+	if err := EmitTx(context.Background(), r.db, topic, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// outboxRows returns the events in the outbox, oldest first.
+func outboxRows(t *testing.T, r *relay) []OutboxEvent {
+	t.Helper()
+	var events []OutboxEvent
+	if err := r.db.NewSelect().Model(&events).OrderExpr("id ASC").Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// makeAvailable ends every lease and backoff.
+func makeAvailable(t *testing.T, r *relay) {
+	t.Helper()
+	_, err := r.db.NewUpdate().Model((*OutboxEvent)(nil)).
+		Set("available_at = ?", time.Now().Add(-time.Second)).
+		Where("id > 0").
+		Exec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func poll(t *testing.T, r *relay) int {
+	t.Helper()
+	n, err := r.poll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRelayDelivers(t *testing.T) {
+	r := testRelay(t, RelayConfig{})
+	var got []string
+	subscribe(t, "test.deliver", func(ctx context.Context, e *Envelope) error {
+		var s string
+		if err := e.Decode(&s); err != nil {
+			return err
+		}
+		got = append(got, s)
+		return nil
+	})
+	emit(t, r, "test.deliver", "a")
+	emit(t, r, "test.deliver", "b")
+
+	if n := poll(t, r); n != 2 {
+		t.Errorf("delivered %d events, want 2", n)
+	}
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("handler got %v, want them in order", got)
+	}
+	for _, e := range outboxRows(t, r) {
+		if e.DeliveredAt.IsZero() {
+			t.Errorf("event %d not marked delivered", e.ID)
+		}
+	}
+	if n := poll(t, r); n != 0 {
+		t.Errorf("delivered events were delivered again: %d", n)
+	}
+}
+
+func TestRelayRetriesWithBackoff(t *testing.T) {
+	r := testRelay(t, RelayConfig{RetryBackoff: time.Minute, MaxAttempts: 5})
+	subscribe(t, "test.retry", func(ctx context.Context, e *Envelope) error {
+		return errors.New("smtp down")
+	})
+	emit(t, r, "test.retry", "a")
+
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		start := time.Now()
+		poll(t, r)
+		e := outboxRows(t, r)[0]
+		if e.Attempts != attempt+1 || e.LastError != "smtp down" || !e.DeliveredAt.IsZero() {
+			t.Fatalf("after failure %d: %+v", attempt+1, e)
+		}
+		if e.AvailableAt.Before(start.Add(backoff)) || e.AvailableAt.After(time.Now().Add(backoff)) {
+			t.Errorf("after failure %d: available at %s, want in %s", attempt+1, e.AvailableAt, backoff)
+		}
+		// The event waits for its backoff.
+		if n := poll(t, r); n != 0 {
+			t.Errorf("after failure %d: retried before the backoff", attempt+1)
+		}
+		makeAvailable(t, r)
+	}
+}
+
+func TestRelayDeadLetters(t *testing.T) {
+	r := testRelay(t, RelayConfig{MaxAttempts: 2})
+	subscribe(t, "test.dead", func(ctx context.Context, e *Envelope) error {
+		return errors.New("broken")
+	})
+	emit(t, r, "test.dead", "a")
+	id := outboxRows(t, r)[0].ID
+
+	poll(t, r)
+	if len(outboxRows(t, r)) != 1 {
+		t.Fatal("event dead-lettered before MaxAttempts")
+	}
+	makeAvailable(t, r)
+	poll(t, r)
+
+	if rows := outboxRows(t, r); len(rows) != 0 {
+		t.Errorf("dead-lettered event still in the outbox: %+v", rows)
+	}
+	letters, err := DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].EventID != id || letters[0].Attempts != 2 || letters[0].LastError != "broken" {
+		t.Errorf("dead letters = %+v", letters)
+	}
+}
+
+func TestClaimSkipsLockedAndLeasedEvents(t *testing.T) {
+	r := testRelay(t, RelayConfig{Lease: time.Minute})
+	subscribe(t, "test.claim", func(ctx context.Context, e *Envelope) error { return nil })
+	emit(t, r, "test.claim", "a")
+	emit(t, r, "test.claim", "b")
+	rows := outboxRows(t, r)
+	ctx := context.Background()
+	claim := func() []int64 {
+		t.Helper()
+		events, err := r.claim(ctx, []string{"test.claim"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	// Another relay holds the first event.
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.NewSelect().Model(&OutboxEvent{}).Where("id = ?", rows[0].ID).For("UPDATE").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); len(ids) != 1 || ids[0] != rows[1].ID {
+		t.Errorf("claimed %v next to a locked event, want [%d]", ids, rows[1].ID)
+	}
+	tx.Rollback()
+
+	// The second is leased now, the first is free again.
+	if ids := claim(); len(ids) != 1 || ids[0] != rows[0].ID {
+		t.Errorf("claimed %v, want [%d]", ids, rows[0].ID)
+	}
+	if ids := claim(); len(ids) != 0 {
+		t.Errorf("claimed leased events %v", ids)
+	}
+
+	// Leases of relays that died run out.
+	makeAvailable(t, r)
+	if ids := claim(); len(ids) != 2 {
+		t.Errorf("claimed %v after the leases ran out, want both", ids)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	r := testRelay(t, RelayConfig{Retention: time.Hour})
+	subscribe(t, "test.kept", func(ctx context.Context, e *Envelope) error { return nil })
+	ctx := context.Background()
+	old, recent := time.Now().Add(-2*time.Hour), time.Now()
+	insert := func(topic string, created time.Time, delivered bool) int64 {
+		t.Helper()
+		e := &OutboxEvent{Topic: topic, Payload: json.RawMessage(`{}`), CreatedAt: created}
+		if delivered {
+			e.DeliveredAt = bun.NullTime{Time: created}
+		}
+		if _, err := r.db.NewInsert().Model(e).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return e.ID
+	}
+	insert("test.kept", old, true)
+	pending := insert("test.kept", old, false)
+	fresh := insert("test.kept", recent, true)
+	insert("test.orphan", old, false)
+
+	n, err := r.prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("pruned %d events, want 2", n)
+	}
+	var left []int64
+	for _, e := range outboxRows(t, r) {
+		left = append(left, e.ID)
+	}
+	if len(left) != 2 || left[0] != pending || left[1] != fresh {
+		t.Errorf("left %v, want the pending and the recent event [%d %d]", left, pending, fresh)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	r := testRelay(t, RelayConfig{})
+	calls := map[string]int{}
+	for _, topic := range []string{"test.replay", "test.other"} {
+		subscribe(t, topic, func(ctx context.Context, e *Envelope) error {
+			calls[e.Topic]++
+			return nil
+		})
+	}
+	emit(t, r, "test.replay", "a")
+	emit(t, r, "test.replay", "b")
+	emit(t, r, "test.other", "c")
+	poll(t, r)
+
+	ctx := context.Background()
+	if n, err := Replay(ctx, time.Now().Add(time.Hour)); err != nil || n != 0 {
+		t.Errorf("Replay of the future = %d, %v", n, err)
+	}
+	n, err := Replay(ctx, time.Now().Add(-time.Hour), "test.replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("replayed %d events, want 2", n)
+	}
+	poll(t, r)
+	if calls["test.replay"] != 4 || calls["test.other"] != 1 {
+		t.Errorf("deliveries = %v, want test.replay twice more", calls)
+	}
+}
@@ -0,0 +1,78 @@
+package filter
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// Apply adds the conditions, order and limit of spec to q. The limit is one
+// more than the page size so Paginate can tell whether there is a next
+// page.
+func (s *Schema) Apply(q *bun.SelectQuery, spec Spec) (*bun.SelectQuery, Spec, error) {
+	spec, err := s.check(spec)
+	if err != nil {
+		return q, spec, err
+	}
+
+	for _, c := range spec.Where {
+		col := bun.Safe(s.columns[c.Field].Expr)
+		switch c.Op {
+		case Eq:
+			if s.columns[c.Field].Kind == Tags {
+				q = q.Where("? = ANY(?)", c.Value, col)
+				break
+			}
+			q = q.Where("? = ?", col, c.Value)
+		case In:
+			q = q.Where("? IN (?)", col, bun.In(c.Value))
+		case Lt:
+			q = q.Where("? < ?", col, c.Value)
+		case Lte:
+			q = q.Where("? <= ?", col, c.Value)
+		case Gt:
+			q = q.Where("? > ?", col, c.Value)
+		case Gte:
+			q = q.Where("? >= ?", col, c.Value)
+		case Like:
+			q = q.Where("? ILIKE ? ESCAPE '\\'", col, "%"+escapeLike(c.Value.(string))+"%")
+		case Prefix:
+			q = q.Where("? LIKE ? ESCAPE '\\'", col, escapeLike(c.Value.(string))+"%")
+		}
+	}
+
+	sortCol, keyCol := bun.Safe(s.columns[spec.Sort.Field].Expr), bun.Safe(s.key.Expr)
+	dir, cmp := bun.Safe("ASC"), bun.Safe(">")
+	if spec.Sort.Desc {
+		dir, cmp = bun.Safe("DESC"), bun.Safe("<")
+	}
+
+	cur, err := s.decodeCursor(spec)
+	if err != nil {
+		return q, spec, err
+	}
+	if cur != nil {
+		q = q.Where("(?, ?) ? (?, ?)", sortCol, keyCol, cmp, cur.sort, cur.key)
+	}
+
+	q = q.OrderExpr("? ?, ? ?", sortCol, dir, keyCol, dir).Limit(spec.Limit + 1)
+	return q, spec, nil
+}
+
+// List selects a page of T from db. prepare may add joins and relations to
+// the query before spec is applied.
+func List[T any](ctx context.Context, db bun.IDB, s *Schema, spec Spec, prepare ...func(*bun.SelectQuery) *bun.SelectQuery) (Page[T], error) {
+	var items []T
+	q := db.NewSelect().Model(&items)
+	for _, p := range prepare {
+		q = p(q)
+	}
+	q, spec, err := s.Apply(q, spec)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	if err := q.Scan(ctx); err != nil {
+		return Page[T]{}, err
+	}
+	return page(s, spec, items), nil
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// cursor points behind the last item of a page.
+type cursor struct {
+	sort, key any
+}
+
+func (s *Schema) encodeCursor(spec Spec, item any) string {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	parts := [2]string{
+		formatValue(s.columns[spec.Sort.Field], v),
+		formatValue(s.key, v),
+	}
+	b, _ := json.Marshal(parts)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func formatValue(col Column, item reflect.Value) string {
+	f := field(col, item)
+	switch col.Kind {
+	case Int:
+		return strconv.FormatInt(f.Int(), 10)
+	case Time:
+		return f.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+	default:
+		return f.String()
+	}
+}
+
+func (s *Schema) decodeCursor(spec Spec) (*cursor, error) {
+	if spec.After == "" {
+		return nil, nil
+	}
+	bad := fmt.Errorf("%w: bad cursor", ErrInvalid)
+	b, err := base64.RawURLEncoding.DecodeString(spec.After)
+	if err != nil {
+		return nil, bad
+	}
+	var parts [2]string
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return nil, bad
+	}
+	sortValue, err := convertOne(s.columns[spec.Sort.Field], parts[0])
+	if err != nil {
+		return nil, bad
+	}
+	keyValue, err := convertOne(s.key, parts[1])
+	if err != nil {
+		return nil, bad
+	}
+	return &cursor{sort: sortValue, key: keyValue}, nil
+}
+
+// page trims items fetched with one extra row to the limit of spec and sets
+// the cursor of the next page.
+func page[T any](s *Schema, spec Spec, items []T) Page[T] {
+	if len(items) <= spec.Limit {
+		return Page[T]{Items: items}
+	}
+	items = items[:spec.Limit]
+	return Page[T]{Items: items, Next: s.encodeCursor(spec, items[len(items)-1])}
+}
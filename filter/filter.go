@@ -0,0 +1,315 @@
+// Package filter is a typed query spec for list endpoints. A Schema
+// allow-lists the columns of a model that may be filtered and sorted on, so
+// field names coming from a request never reach SQL unchecked.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Eq     Op = "eq"
+	In     Op = "in"
+	Lt     Op = "lt"
+	Lte    Op = "lte"
+	Gt     Op = "gt"
+	Gte    Op = "gte"
+	Like   Op = "like"   // case-insensitive substring match
+	Prefix Op = "prefix" // case-sensitive prefix match
+)
+
+// Kind is the type of a column.
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Time
+	// Tags is a text array column. Eq matches rows holding the tag.
+	Tags
+)
+
+// ErrInvalid is wrapped by every error caused by a bad spec.
+var ErrInvalid = errors.New("invalid filter")
+
+// Column is a column that may be filtered or sorted on.
+type Column struct {
+	// Name is the name used in specs and query strings.
+	Name string
+	// Expr is the SQL column, qualified with the table alias if needed.
+	Expr string
+	// Field is the Go struct field holding the value. Fields of embedded
+	// relations are written as Service.ServiceName.
+	Field string
+	Kind  Kind
+	// Sortable allows sorting on the column.
+	Sortable bool
+}
+
+// Cond is a single condition. Value is a string, int64 or time.Time
+// matching the column kind, or a slice of them for In. Values of other
+// types are converted when the spec is checked.
+type Cond struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+// Sort orders by a column.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Spec selects a page of records.
+type Spec struct {
+	Where []Cond
+	// Sort defaults to the schema's default sort.
+	Sort Sort
+	// Limit defaults to DefaultLimit and is capped at MaxLimit.
+	Limit int
+	// After is the Next cursor of the previous page.
+	After string
+}
+
+// Page is one page of results.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Next is the cursor of the following page, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Schema holds the allow-listed columns of a model.
+type Schema struct {
+	columns map[string]Column
+	key     Column
+	sort    Sort
+}
+
+// NewSchema returns a schema. key is a unique column used to break ties when
+// sorting, and sort is the default order.
+func NewSchema(key Column, sort Sort, columns ...Column) *Schema {
+	s := &Schema{
+		columns: make(map[string]Column, len(columns)+1),
+		key:     key,
+		sort:    sort,
+	}
+	key.Sortable = true
+	s.columns[key.Name] = key
+	for _, c := range columns {
+		s.columns[c.Name] = c
+	}
+	if _, ok := s.columns[sort.Field]; !ok {
+		panic("filter: unknown default sort column " + sort.Field)
+	}
+	return s
+}
+
+// Where is a shorthand for building a Cond.
+func Where(field string, op Op, value any) Cond {
+	return Cond{Field: field, Op: op, Value: value}
+}
+
+// check validates spec against the schema and converts the values to the
+// kinds of their columns.
+func (s *Schema) check(spec Spec) (Spec, error) {
+	out := spec
+	out.Where = make([]Cond, 0, len(spec.Where))
+	for _, c := range spec.Where {
+		col, ok := s.columns[c.Field]
+		if !ok {
+			return spec, fmt.Errorf("%w: unknown field %q", ErrInvalid, c.Field)
+		}
+		if !validOp(col.Kind, c.Op) {
+			return spec, fmt.Errorf("%w: operator %q not allowed on %q", ErrInvalid, c.Op, c.Field)
+		}
+		v, err := convert(col, c.Op, c.Value)
+		if err != nil {
+			return spec, err
+		}
+		out.Where = append(out.Where, Cond{Field: c.Field, Op: c.Op, Value: v})
+	}
+
+	if out.Sort.Field == "" {
+		out.Sort = s.sort
+	}
+	if col, ok := s.columns[out.Sort.Field]; !ok || !col.Sortable || col.Kind == Tags {
+		return spec, fmt.Errorf("%w: can't sort on %q", ErrInvalid, out.Sort.Field)
+	}
+
+	if out.Limit <= 0 {
+		out.Limit = DefaultLimit
+	}
+	out.Limit = min(out.Limit, MaxLimit)
+	return out, nil
+}
+
+func validOp(k Kind, op Op) bool {
+	if k == Tags {
+		return op == Eq
+	}
+	switch op {
+	case Eq, In, Lt, Lte, Gt, Gte:
+		return true
+	case Like, Prefix:
+		return k == String
+	default:
+		return false
+	}
+}
+
+func convert(col Column, op Op, v any) (any, error) {
+	if op != In {
+		return convertOne(col, v)
+	}
+
+	var in []any
+	switch vs := v.(type) {
+	case string:
+		for _, p := range strings.Split(vs, ",") {
+			in = append(in, p)
+		}
+	case []string:
+		for _, p := range vs {
+			in = append(in, p)
+		}
+	case []int:
+		for _, p := range vs {
+			in = append(in, p)
+		}
+	case []int64:
+		for _, p := range vs {
+			in = append(in, p)
+		}
+	case []any:
+		in = vs
+	default:
+		return nil, fmt.Errorf("%w: %q needs a list", ErrInvalid, col.Name)
+	}
+	if len(in) == 0 {
+		return nil, fmt.Errorf("%w: %q needs a non-empty list", ErrInvalid, col.Name)
+	}
+	out := make([]any, len(in))
+	for i, p := range in {
+		c, err := convertOne(col, p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+func convertOne(col Column, v any) (any, error) {
+	bad := fmt.Errorf("%w: bad value for %q", ErrInvalid, col.Name)
+	switch col.Kind {
+	case Int:
+		switch n := v.(type) {
+		case int:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case string:
+			i, err := strconv.ParseInt(n, 10, 64)
+			if err != nil {
+				return nil, bad
+			}
+			return i, nil
+		}
+		// Named integer types like data.Plan.
+		if rv := reflect.ValueOf(v); rv.CanInt() {
+			return rv.Int(), nil
+		}
+	case Time:
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			if p, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return p, nil
+			}
+			if p, err := time.Parse(time.DateOnly, t); err == nil {
+				return p, nil
+			}
+			return nil, bad
+		}
+	case String, Tags:
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case fmt.Stringer:
+			return s.String(), nil
+		}
+	}
+	return nil, bad
+}
+
+// Parse reads a spec from query parameters. Filters are written as
+// field=value or field=op:value, for example status=in:healthy,expired or
+// host_name=like:example, or as field[op]=value, which suits HTML forms:
+// created_at[gte]=2024-01-01. Empty values are skipped. sort=-created_at
+// sorts descending, limit and after select the page. Parameters that are
+// not columns are ignored.
+func (s *Schema) Parse(q url.Values) (Spec, error) {
+	var spec Spec
+	keys := make([]string, 0, len(q))
+	for key := range q {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name, keyOp := key, Op("")
+		if n, rest, ok := strings.Cut(key, "["); ok && strings.HasSuffix(rest, "]") {
+			name, keyOp = n, Op(strings.TrimSuffix(rest, "]"))
+		}
+		if _, ok := s.columns[name]; !ok {
+			continue
+		}
+		for _, v := range q[key] {
+			if v == "" {
+				continue
+			}
+			op := keyOp
+			if op == "" {
+				op = Eq
+				if o, rest, ok := strings.Cut(v, ":"); ok && validOp(String, Op(o)) {
+					op, v = Op(o), rest
+				}
+			}
+			spec.Where = append(spec.Where, Cond{Field: name, Op: op, Value: v})
+		}
+	}
+
+	if order := q.Get("sort"); order != "" {
+		spec.Sort.Field, spec.Sort.Desc = strings.CutPrefix(order, "-")
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return spec, fmt.Errorf("%w: bad limit", ErrInvalid)
+		}
+		spec.Limit = n
+	}
+	spec.After = q.Get("after")
+
+	return s.check(spec)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type row struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+}
+
+var rowSchema = NewSchema(
+	Column{Name: "id", Expr: "id", Field: "ID", Kind: Int},
+	Sort{Field: "created_at", Desc: true},
+	Column{Name: "name", Expr: "name", Field: "Name", Kind: String, Sortable: true},
+	Column{Name: "created_at", Expr: "created_at", Field: "CreatedAt", Kind: Time, Sortable: true},
+)
+
+func TestParseRejectsUnknownColumns(t *testing.T) {
+	spec, err := rowSchema.Parse(url.Values{"name": {"like:foo"}, "password": {"x"}, "sort": {"-name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Where) != 1 || spec.Where[0] != (Cond{Field: "name", Op: Like, Value: "foo"}) {
+		t.Fatalf("where = %+v", spec.Where)
+	}
+	if spec.Sort != (Sort{Field: "name", Desc: true}) {
+		t.Fatalf("sort = %+v", spec.Sort)
+	}
+
+	for _, q := range []url.Values{
+		{"sort": {"password"}},
+		{"id": {"like:1"}},
+		{"id": {"abc"}},
+		{"limit": {"-1"}},
+		{"after": {"garbage"}},
+	} {
+		spec, err := rowSchema.Parse(q)
+		if err == nil {
+			_, err = Slice[row](rowSchema, spec, nil)
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%v: err = %v, want ErrInvalid", q, err)
+		}
+	}
+}
+
+func TestSlicePaginates(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rows []row
+	for i := 1; i <= 7; i++ {
+		// Pairs of rows share a timestamp, so the id has to break ties.
+		rows = append(rows, row{ID: i, Name: "host", CreatedAt: base.Add(time.Duration(i/2) * time.Hour)})
+	}
+
+	spec := Spec{Where: []Cond{Where("id", In, []int{1, 2, 3, 4, 5, 6})}, Limit: 4}
+	var got []int
+	for {
+		p, err := Slice(rowSchema, spec, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range p.Items {
+			got = append(got, r.ID)
+		}
+		if p.Next == "" {
+			break
+		}
+		spec.After = p.Next
+	}
+
+	want := []int{6, 5, 4, 3, 2, 1}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSlicePrefix(t *testing.T) {
+	rows := []row{{ID: 1, Name: "auth.login"}, {ID: 2, Name: "host.auth.create"}, {ID: 3, Name: "auth_x"}}
+
+	spec, err := rowSchema.Parse(url.Values{"name": {"prefix:auth."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Slice(rowSchema, spec, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Items) != 1 || p.Items[0].ID != 1 {
+		t.Fatalf("got %+v, want only auth.login", p.Items)
+	}
+}
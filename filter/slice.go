@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Slice applies spec to items in memory, the way Apply does in SQL. It is
+// used by the in-memory repositories.
+func Slice[T any](s *Schema, spec Spec, items []T) (Page[T], error) {
+	spec, err := s.check(spec)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	cur, err := s.decodeCursor(spec)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	sortCol := s.columns[spec.Sort.Field]
+	less := func(a, b reflect.Value) int {
+		if c := compare(value(sortCol, a), value(sortCol, b)); c != 0 {
+			return c
+		}
+		return compare(value(s.key, a), value(s.key, b))
+	}
+	if spec.Sort.Desc {
+		asc := less
+		less = func(a, b reflect.Value) int { return -asc(a, b) }
+	}
+
+	var out []T
+	for _, item := range items {
+		v := reflect.Indirect(reflect.ValueOf(item))
+		if !s.match(spec, v) {
+			continue
+		}
+		if cur != nil {
+			c := compare(value(sortCol, v), cur.sort)
+			if c == 0 {
+				c = compare(value(s.key, v), cur.key)
+			}
+			if spec.Sort.Desc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		out = append(out, item)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return less(reflect.Indirect(reflect.ValueOf(out[i])), reflect.Indirect(reflect.ValueOf(out[j]))) < 0
+	})
+	if len(out) > spec.Limit+1 {
+		out = out[:spec.Limit+1]
+	}
+	return page(s, spec, out), nil
+}
+
+func (s *Schema) match(spec Spec, v reflect.Value) bool {
+	for _, c := range spec.Where {
+		got := value(s.columns[c.Field], v)
+		var ok bool
+		switch c.Op {
+		case Eq:
+			if tags, isTags := got.([]string); isTags {
+				ok = slices.Contains(tags, c.Value.(string))
+				break
+			}
+			ok = compare(got, c.Value) == 0
+		case In:
+			for _, want := range c.Value.([]any) {
+				if compare(got, want) == 0 {
+					ok = true
+					break
+				}
+			}
+		case Lt:
+			ok = compare(got, c.Value) < 0
+		case Lte:
+			ok = compare(got, c.Value) <= 0
+		case Gt:
+			ok = compare(got, c.Value) > 0
+		case Gte:
+			ok = compare(got, c.Value) >= 0
+		case Like:
+			ok = strings.Contains(strings.ToLower(got.(string)), strings.ToLower(c.Value.(string)))
+		case Prefix:
+			ok = strings.HasPrefix(got.(string), c.Value.(string))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// value returns the value of col in the struct v as string, int64,
+// time.Time or []string.
+func value(col Column, v reflect.Value) any {
+	f := field(col, v)
+	switch col.Kind {
+	case Int:
+		return f.Int()
+	case Time:
+		return f.Interface().(time.Time)
+	case Tags:
+		return f.Interface().([]string)
+	default:
+		return f.String()
+	}
+}
+
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// field returns the struct field of col in v, following embedded
+// relations.
+func field(col Column, v reflect.Value) reflect.Value {
+	for _, name := range strings.Split(col.Field, ".") {
+		v = reflect.Indirect(v).FieldByName(name)
+	}
+	return v
+}
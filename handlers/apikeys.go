@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyExpiries are the lifetimes in days a key can be created with, ""
+// for keys that never expire.
+var apiKeyExpiries = []string{"30", "90", "365", ""}
+
+var apiKeySchema = v.Schema{
+	"name":    v.Rules(v.Required, v.Max(100)),
+	"kind":    v.Rules(v.In([]string{layouts.APIKeyPersonal, layouts.APIKeyOrganization})),
+	"expires": v.Rules(v.In(apiKeyExpiries)),
+}
+
+// withKeyAccount scopes a request made with an API key to the account of
+// the key. A personal key only works while its owner is a member, with
+// their current role, and like them needs two-factor authentication if the
+// account requires it.
+func withKeyAccount(c *fiber.Ctx, user *data.AuthenticatedUser, k *data.APIKey) error {
+	ctx := c.UserContext()
+	m := &data.Membership{AccountID: k.AccountID, AccessLevel: data.RoleOwner}
+	if k.Personal() {
+		ms, err := repos.Members.Memberships(ctx, k.UserID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(ms, func(m data.Membership) bool { return m.AccountID == k.AccountID })
+		if i < 0 {
+			return fiber.ErrUnauthorized
+		}
+		m = &ms[i]
+	}
+	c.Locals("membership", m)
+	user.AccessLevel = m.AccessLevel
+	c.SetUserContext(data.WithAccount(ctx, m.AccountID))
+	logEvent.SetCtx(c, logEvent.FromCtx(c).With("account_id", m.AccountID))
+	if k.Personal() {
+		if ok, err := requireTwoFactor(c, user, m); !ok {
+			return err
+		}
+	}
+	return c.Next()
+}
+
+// canManageKeys reports whether the user may manage every key of the
+// account, not just their own.
+func canManageKeys(c *fiber.Ctx) bool {
+	return can(c, data.PermAccountWrite)
+}
+
+// HandleGetAPIKeys lists the API keys of the user, and every key of the
+// account to those who manage it.
+func HandleGetAPIKeys(c *fiber.Ctx) error {
+	return renderAPIKeys(c, layouts.APIKeyParams{Kind: layouts.APIKeyPersonal, Expires: "90"}, nil, "")
+}
+
+func renderAPIKeys(c *fiber.Ctx, params layouts.APIKeyParams, errs v.Errors, secret string) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	if user == nil || m == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	keys, err := repos.APIKeys.List(c.UserContext(), m.AccountID)
+	if err != nil {
+		return err
+	}
+	page := layouts.APIKeysPage{
+		UserID:    user.ID,
+		CanManage: canManageKeys(c),
+		Params:    params,
+		Errors:    errs,
+		Secret:    secret,
+	}
+	for _, k := range keys {
+		if page.CanManage || k.UserID == user.ID {
+			page.Keys = append(page.Keys, k)
+		}
+	}
+	for _, s := range data.APIKeyScopes {
+		if scopeGranted(m.AccessLevel, s) {
+			page.Scopes = append(page.Scopes, s)
+		}
+	}
+	return Render(c, layouts.APIKeysIndex(page))
+}
+
+// scopeGranted reports whether a user with role may give a key scope.
+// Nobody can hand out more than their own role.
+func scopeGranted(role data.Role, scope string) bool {
+	return scope == data.ScopeRead || role.Can(data.Permission(scope))
+}
+
+// HandlePostCreateAPIKey creates a key and shows its secret, once.
+// Organization keys take account:write.
+func HandlePostCreateAPIKey(c *fiber.Ctx) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	if user == nil || m == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	var params layouts.APIKeyParams
+	errs, ok := v.Request(c.Context(), &params, apiKeySchema)
+	for _, s := range c.Context().PostArgs().PeekMulti("scopes") {
+		params.Scopes = append(params.Scopes, string(s))
+	}
+	if len(params.Scopes) == 0 {
+		errs.Add("scopes", "choose at least one scope")
+		ok = false
+	}
+	for _, s := range params.Scopes {
+		if !slices.Contains(data.APIKeyScopes, s) || !scopeGranted(m.AccessLevel, s) {
+			errs.Add("scopes", "can't grant "+s)
+			ok = false
+		}
+	}
+	if !ok {
+		return renderAPIKeys(c, params, errs, "")
+	}
+	if params.Kind == layouts.APIKeyOrganization && !canManageKeys(c) {
+		return deny(c, data.PermAccountWrite)
+	}
+
+	k, secret := data.NewAPIKey(m.AccountID, params.Name, params.Scopes)
+	k.CreatedBy = user.ID
+	if params.Kind == layouts.APIKeyPersonal {
+		k.UserID = user.ID
+	}
+	if days, err := strconv.Atoi(params.Expires); err == nil {
+		expires := time.Now().AddDate(0, 0, days)
+		k.ExpiresAt = &expires
+	}
+	if err := repos.APIKeys.Create(c.UserContext(), k); err != nil {
+		return err
+	}
+	return renderAPIKeys(c, layouts.APIKeyParams{Kind: layouts.APIKeyPersonal, Expires: "90"}, nil, secret)
+}
+
+// HandlePostRevokeAPIKey revokes a key. Users revoke their own keys, those
+// who manage the account any key of it.
+func HandlePostRevokeAPIKey(c *fiber.Ctx) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	if user == nil || m == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	ctx := c.UserContext()
+	keys, err := repos.APIKeys.List(ctx, m.AccountID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(keys, func(k data.APIKey) bool { return k.ID == id })
+	if i < 0 {
+		return fiber.ErrNotFound
+	}
+	if keys[i].UserID != user.ID && !canManageKeys(c) {
+		return deny(c, data.PermAccountWrite)
+	}
+	err = repos.APIKeys.Revoke(ctx, m.AccountID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return HXRedirect(c, "/account/keys")
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestAPIKeys(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+	middleware.Init(repos.Sessions, repos.APIKeys)
+	ctx := context.Background()
+	acc, err := repos.Accounts.Create(ctx, &supabase.User{ID: "u1", Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey := func(userID string, scopes ...string) (*data.APIKey, string) {
+		k, secret := data.NewAPIKey(acc.ID, "ci", scopes)
+		k.UserID = userID
+		if err := repos.APIKeys.Create(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+		return k, secret
+	}
+
+	app := fiber.New()
+	app.Use(middleware.OptionalAuth, WithAccount)
+	api := app.Group("/api", middleware.RequireAuth)
+	api.Get("/hosts", RequirePermission(data.PermHostsRead), HandleAPIGetHosts)
+	api.Post("/hosts", RequirePermission(data.PermHostsWrite), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	do := func(method, target, secret string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+secret)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	personal, secret := newKey("u1", data.ScopeRead)
+	if status := do("GET", "/api/hosts", secret); status != fiber.StatusOK {
+		t.Errorf("read with a read key: status %d", status)
+	}
+	if status := do("POST", "/api/hosts", secret); status != fiber.StatusForbidden {
+		t.Errorf("write with a read key: status %d", status)
+	}
+	if k, _ := repos.APIKeys.GetByHash(ctx, personal.Hash); k.LastUsedAt == nil || k.LastUsedIP == "" {
+		t.Errorf("last use not recorded: %+v", k)
+	}
+
+	// Organization keys need no member behind them.
+	_, orgSecret := newKey("", string(data.PermHostsWrite))
+	if status := do("POST", "/api/hosts", orgSecret); status != fiber.StatusCreated {
+		t.Errorf("write with an organization key: status %d", status)
+	}
+
+	// Personal keys stop working with their owner's membership.
+	_, gone := newKey("u2", data.ScopeRead)
+	if status := do("GET", "/api/hosts", gone); status != fiber.StatusUnauthorized {
+		t.Errorf("key of a former member: status %d", status)
+	}
+
+	if err := repos.APIKeys.Revoke(ctx, acc.ID, personal.ID); err != nil {
+		t.Fatal(err)
+	}
+	expired, expiredSecret := newKey("u1", data.ScopeRead)
+	past := time.Now().Add(-time.Minute)
+	store.APIKeys[expired.ID].ExpiresAt = &past
+	for name, s := range map[string]string{"revoked": secret, "expired": expiredSecret, "unknown": data.APIKeyPrefix + "guess"} {
+		if status := do("GET", "/api/hosts", s); status != fiber.StatusUnauthorized {
+			t.Errorf("%s key: status %d", name, status)
+		}
+	}
+
+	// Personal keys need 2FA of their owner where the account requires it.
+	acc.Require2FA = true
+	if err := repos.Accounts.Update(ctx, acc); err != nil {
+		t.Fatal(err)
+	}
+	_, secret = newKey("u1", data.ScopeRead)
+	if status := do("GET", "/api/hosts", secret); status != fiber.StatusForbidden {
+		t.Errorf("personal key without 2FA: status %d", status)
+	}
+	if status := do("POST", "/api/hosts", orgSecret); status != fiber.StatusCreated {
+		t.Errorf("organization key without 2FA: status %d", status)
+	}
+	if err := repos.TwoFactor.Begin(ctx, &data.TwoFactor{UserID: "u1", Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(ctx, "u1", 0, data.NewRecoveryCodes()); err != nil {
+		t.Fatal(err)
+	}
+	if status := do("GET", "/api/hosts", secret); status != fiber.StatusOK {
+		t.Errorf("personal key with 2FA: status %d", status)
+	}
+}
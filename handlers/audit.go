@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetAudit renders the audit log of the account of the signed in user.
+func HandleGetAudit(c *fiber.Ctx) error {
+	params, scope, spec, err := auditSpec(c)
+	if err == fiber.ErrUnauthorized {
+		return HXRedirect(c, "/auth/login")
+	}
+	if err != nil {
+		return err
+	}
+	page, err := repos.Audit.List(c.UserContext(), scope, spec)
+	if err != nil {
+		return listError(err)
+	}
+	params.Next = page.Next
+	return Render(c, layouts.AuditIndex(params, page.Items))
+}
+
+// maxAuditExport caps the number of entries in an export.
+const maxAuditExport = 10000
+
+// HandleGetAuditExport returns the audit log as a JSON download.
+func HandleGetAuditExport(c *fiber.Ctx) error {
+	_, scope, spec, err := auditSpec(c)
+	if err != nil {
+		return err
+	}
+	spec.Limit = filter.MaxLimit
+	entries := []data.AuditEntry{}
+	for len(entries) < maxAuditExport {
+		page, err := repos.Audit.List(c.UserContext(), scope, spec)
+		if err != nil {
+			return listError(err)
+		}
+		entries = append(entries, page.Items...)
+		if page.Next == "" {
+			break
+		}
+		spec.After = page.Next
+	}
+	c.Attachment("audit-" + time.Now().UTC().Format("20060102") + ".json")
+	return c.JSON(entries)
+}
+
+// auditSpec reads the filters of the audit page from the query string.
+func auditSpec(c *fiber.Ctx) (layouts.AuditParams, data.AuditScope, filter.Spec, error) {
+	params := layouts.AuditParams{
+		Action: c.Query("action"),
+		Since:  c.Query("since"),
+		Until:  c.Query("until"),
+	}
+	spec := filter.Spec{After: c.Query("after")}
+
+	user := getAuthenticatedUser(c)
+	if user == nil || !user.LoggedIn {
+		return params, data.AuditScope{}, spec, fiber.ErrUnauthorized
+	}
+	scope := data.AuditScope{UserID: user.ID}
+	if m := currentMembership(c); m != nil {
+		scope.AccountID = m.AccountID
+	}
+
+	switch {
+	case params.Action == "":
+	case !strings.Contains(params.Action, "."):
+		// A group of actions like "auth" or "host".
+		spec.Where = append(spec.Where, filter.Where("action", filter.Prefix, params.Action+"."))
+	default:
+		spec.Where = append(spec.Where, filter.Where("action", filter.Eq, params.Action))
+	}
+	if params.Since != "" {
+		t, err := time.Parse(time.DateOnly, params.Since)
+		if err != nil {
+			return params, scope, spec, fiber.NewError(fiber.StatusBadRequest, "invalid since date")
+		}
+		spec.Where = append(spec.Where, filter.Where("created_at", filter.Gte, t))
+	}
+	if params.Until != "" {
+		t, err := time.Parse(time.DateOnly, params.Until)
+		if err != nil {
+			return params, scope, spec, fiber.NewError(fiber.StatusBadRequest, "invalid until date")
+		}
+		// Include the whole day.
+		spec.Where = append(spec.Where, filter.Where("created_at", filter.Lt, t.AddDate(0, 0, 1)))
+	}
+	return params, scope, spec, nil
+}
+
+// audit records an action that isn't part of a data layer transaction, like
+// a login. userID and email override the actor of the request when set.
+// Failures are logged, they never fail the request.
+func audit(c *fiber.Ctx, userID, email string, rec data.AuditRecord) {
+	ctx := c.UserContext()
+	actor := data.ActorFrom(ctx)
+	if actor.IP == "" {
+		actor.IP, actor.UserAgent = c.IP(), c.Get(fiber.HeaderUserAgent)
+	}
+	if userID != "" || email != "" {
+		actor.UserID, actor.Email = userID, email
+	}
+	if err := repos.Audit.Record(data.WithActor(ctx, actor), rec); err != nil {
+		logEvent.FromCtx(c).Error("write audit entry", "action", rec.Action, "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestHandleGetAuditExport(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+
+	ctx := data.WithActor(context.Background(), data.Actor{UserID: "u1", Email: "a@example.com"})
+	acc, err := repos.Accounts.Create(ctx, &supabase.User{ID: "u1", Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.Plan = data.PlanBusiness
+	if err := repos.Accounts.Update(ctx, acc); err != nil {
+		t.Fatal(err)
+	}
+	// Entries of other users must not show up.
+	other := data.WithAccount(data.WithActor(context.Background(), data.Actor{UserID: "u2"}), acc.ID+1)
+	if err := repos.Hosts.Create(other, &data.Host{HostName: "example.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, &data.AuthenticatedUser{ID: "u1", LoggedIn: true})
+		return c.Next()
+	}, WithAccount)
+	app.Get("/account/audit/export", HandleGetAuditExport)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/account/audit/export?action=account", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	var entries []data.AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != data.AuditPlanChange {
+		t.Fatalf("entries = %+v, want a single plan change", entries)
+	}
+	if c := entries[0].Diff["Plan"]; c.New != float64(data.PlanBusiness) {
+		t.Errorf("plan change = %+v", c)
+	}
+}
+
+func TestHandleGetAuditExportUnauthorized(t *testing.T) {
+	Init(memory.NewRepos(memory.NewStore()))
+
+	app := fiber.New()
+	app.Get("/account/audit/export", HandleGetAuditExport)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/account/audit/export", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
@@ -2,18 +2,13 @@ package handlers
 
 import (
 	"context"
-	"log"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/NikoMalik/GoTrack/data"
-	"github.com/NikoMalik/GoTrack/db"
-	"github.com/NikoMalik/GoTrack/event"
 	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/middleware"
 	"github.com/NikoMalik/GoTrack/sb"
 	v "github.com/NikoMalik/GoTrack/validate"
-	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/NikoMalik/GoTrack/views/layouts"
 	"github.com/gofiber/fiber/v2"
@@ -44,18 +39,18 @@ func HandleSignupWithEmail(c *fiber.Ctx) error {
 		PasswordConfirmation: c.FormValue("passwordConfirmation"),
 	}
 
-	// Debug: Log received parameters
-	log.Printf("Received params: %+v", &params)
+	l := logEvent.FromCtx(c)
+	l.Debug("signup with email", "params", params)
 
 	// Validate parameters
 	errors, ok := v.Request(c.Context(), &params, signupSchema)
 	if !ok {
-		log.Printf("Validation errors: %+v", errors)
+		l.Debug("signup validation failed", "errors", errors)
 		return Render(c, layouts.SignupForm(params, errors))
 	}
 
 	// Sign up the user
-	resp, err := sb.Client.Auth.SignUp(c.Context(), supabase.UserCredentials{
+	resp, err := sb.Client.Auth.SignUp(c.UserContext(), supabase.UserCredentials{
 		Email:    params.Email,
 		Password: params.Password,
 		Data: map[string]string{
@@ -64,19 +59,36 @@ func HandleSignupWithEmail(c *fiber.Ctx) error {
 	})
 
 	if err != nil {
-
-		log.Printf("SignUp error: %v", err)
+		l.Error("signup failed", "error", err)
 		return c.Status(fiber.StatusInternalServerError).SendString("Signup failed")
 	}
 
-	// Debug: Log the response from Supabase
-	log.Printf("Supabase response: %+v", resp)
+	l.Debug("supabase signup", "id", resp.ID, "email", resp.Email)
+
+	// The local user records whether the address is verified.
+	err = repos.Tx.InTx(c.UserContext(), func(ctx context.Context, r *data.Repos) error {
+		if err := r.Users.Create(ctx, &data.User{
+			ID:        resp.ID,
+			Name:      params.Name,
+			Email:     resp.Email,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+		return r.Publisher.Publish(ctx, data.UserSignupEvent, data.UserWithSignup{User: resp})
+	})
+	if err != nil {
+		l.Error("create local user", "error", err)
+	}
 
-	event.Emit(data.UserSignupEvent, data.UserWithSignup{
-		User: resp,
+	audit(c, resp.ID, resp.Email, data.AuditRecord{
+		Action:     data.AuditSignup,
+		TargetType: "user",
+		TargetID:   resp.ID,
 	})
 
-	logEvent.Log("msg", "user signup with email", "id", resp.ID)
+	l.Info("user signup with email", "id", resp.ID)
 
 	// Email sent automatically by Supabase; just render the success page
 	return Render(c, layouts.SignupSuccess(resp))
@@ -88,22 +100,27 @@ func HandleLoginWithEmail(c *fiber.Ctx) error {
 		Password: c.FormValue("password"),
 	}
 
-	log.Printf("Received params: %+v", &params)
+	l := logEvent.FromCtx(c)
+	l.Debug("login with email", "params", params)
 
 	errors, ok := v.Request(c.Context(), &params, authSchema)
 
 	if !ok {
-		log.Printf("Validation errors: %+v", errors)
+		l.Debug("login validation failed", "errors", errors)
 		return Render(c, layouts.LoginForm(params, errors))
 	}
 
-	resp, err := sb.Client.Auth.SignIn(c.Context(), supabase.UserCredentials{
+	resp, err := sb.Client.Auth.SignIn(c.UserContext(), supabase.UserCredentials{
 		Email:    params.Email,
 		Password: params.Password,
 	})
 
 	if err != nil {
-		log.Printf("Login error: %v", err)
+		l.Warn("login failed", "error", err)
+		audit(c, "", params.Email, data.AuditRecord{
+			Action:     data.AuditLoginFailed,
+			TargetType: "user",
+		})
 		if err.Error() == "invalid_grant: Email not confirmed" {
 			return Render(c, layouts.Toast("Login Error", "Please confirm your email address before logging in."))
 		}
@@ -111,137 +128,56 @@ func HandleLoginWithEmail(c *fiber.Ctx) error {
 		return Render(c, layouts.Toast("Login Error", "Please check your credentials and try again."))
 	}
 
-	if c.Query("access_Token") == "" {
-
-		setAuthCookie(c, resp.AccessToken)
-	}
-
-	event.Emit(data.UserSignupEvent, data.UserWithVerificationToken{
-		User: resp,
-	})
-
-	return HXRedirect(c, "/")
-}
-
-func setAuthCookie(c *fiber.Ctx, accessToken string) {
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_Token",
-		Value:    accessToken,
-		Secure:   true,
-		HTTPOnly: true,
-		SameSite: "Strict",
-	})
+	return signIn(c, resp)
 }
 
-func HandleResendVerificationCode(c *fiber.Ctx) error {
-	id := c.Params("ID")
-
-	var user data.User
-
-	if err := db.Bun.NewSelect().Model(&user).Where("id = ?", id).Scan(context.Background()); err != nil {
-		return err
-	}
-
-	if user.EmailVerifiedAt.Time.After(time.Time{}) {
-		return logEvent.Log("msg", "user already verified", "id", user.ID)
-
-	}
-
-	token, err := createVerificationToken(c, id)
-
+// signIn starts the session of a user whose password or OAuth sign in was
+// accepted. Users with a second factor are signed in once they entered it.
+func signIn(c *fiber.Ctx, details *supabase.AuthenticatedDetails) error {
+	tf, err := twoFactor(c.UserContext(), details.User.ID)
 	if err != nil {
 		return err
 	}
-
-	logEvent.Log("msg", "user verification email sent", "email", user.Email)
-
-	_ = token
-
-	return c.SendStatus(200)
-
-}
-
-func createVerificationToken(c *fiber.Ctx, ID string) (string, error) {
-	expirystr := os.Getenv("AUTH_EMAIL_VERIFICATION_EXPIRY_IN_HOURS")
-	expiry, err := strconv.Atoi(expirystr)
-	if err != nil {
-		expiry = 1
-	}
-
-	claims := jwt.MapClaims{
-		"sub": ID,
-		"exp": time.Now().Add(time.Hour * time.Duration(expiry)).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-
-	if err != nil {
-		log.Printf("token.SignedString: %v", err)
-		return "", c.SendStatus(fiber.StatusInternalServerError)
-	}
-
-	return t, nil
-
-}
-
-func HandleSignInWithGoogle(c *fiber.Ctx) error { // not available yet need google developer keys
-
-	resp, err := sb.Client.Auth.SignInWithProvider(supabase.ProviderSignInOptions{
-		Provider: "google",
-		FlowType: supabase.PKCE,
-	})
-
-	if err != nil {
-		return err
+	if tf.Enabled() {
+		if err := middleware.StartPendingSession(c, details); err != nil {
+			return err
+		}
+		return HXRedirect(c, "/auth/2fa")
 	}
 
-	return c.Redirect(resp.URL)
-}
-
-func HandleSignInWithGithub(c *fiber.Ctx) error {
-
-	resp, err := sb.Client.Auth.SignInWithProvider(supabase.ProviderSignInOptions{
-		Provider:   "github",
-		RedirectTo: "http://localhost:8000/auth/callback",
+	audit(c, details.User.ID, details.User.Email, data.AuditRecord{
+		Action:     data.AuditLogin,
+		TargetType: "user",
+		TargetID:   details.User.ID,
 	})
 
-	if err != nil {
-		logEvent.Log("error", err.Error())
+	if err := middleware.StartSession(c, details); err != nil {
 		return err
 	}
 
-	return HXRedirect(c, resp.URL)
-
+	return HXRedirect(c, "/")
 }
 
 func HandleGetSignOut(c *fiber.Ctx) error {
+	actor := data.ActorFrom(c.UserContext())
+	audit(c, "", "", data.AuditRecord{
+		Action:     data.AuditLogout,
+		TargetType: "user",
+		TargetID:   actor.UserID,
+	})
 
-	if err := sb.Client.Auth.SignOut(c.Context(), c.Cookies("accessToken")); err != nil {
+	if err := middleware.EndSession(c); err != nil {
 		return err
 	}
 
-	c.ClearCookie("access_Token")
-
 	return c.Redirect("/")
 
 }
 
-// base auth func
-func HandleAuthCallback(c *fiber.Ctx) error {
-	accessToken := c.Query("access_Token")
-
-	setAuthCookie(c, accessToken)
-
-	log.Println("Access token successfully set in cookie")
-
-	return HXRedirect(c, "/")
-}
-
 func HandleDeleteUser(c *fiber.Ctx) error {
 	id := c.Params("ID")
 
-	err := sb.Client.DB.From("users").Delete().Eq("id", id).Execute(c.Context())
+	err := sb.Client.DB.From("users").Delete().Eq("id", id).Execute(c.UserContext())
 
 	if err != nil {
 		c.SendStatus(500)
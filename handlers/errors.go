@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"errors"
+
+	"github.com/NikoMalik/GoTrack/filter"
 	"github.com/NikoMalik/GoTrack/logEvent"
 	"github.com/NikoMalik/GoTrack/util"
 	"github.com/NikoMalik/GoTrack/views/errorsTempl"
@@ -21,6 +24,14 @@ func AppError(err error) Error {
 	}
 }
 
+// listError turns an invalid filter into a 400 response.
+func listError(err error) error {
+	if errors.Is(err, filter.ErrInvalid) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return err
+}
+
 // Handle404 handles 404 errors by rendering the 404 error template.
 func Handle404(c *fiber.Ctx) error {
 	if err := Render(c, errorsTempl.Error404()); err != nil {
@@ -37,12 +48,15 @@ func Handle500(c *fiber.Ctx) error {
 	return nil
 }
 
-// ErrorHandler is a custom error handler for Fiber.
 // ErrorHandler is a custom error handler for Fiber.
 func ErrorHandler(c *fiber.Ctx, err error) error {
-	logEvent.Log("error", err.Error())
+	logEvent.FromCtx(c).Error("request failed", "error", err)
+	var fe *fiber.Error
 	if err == fiber.ErrNotFound {
 		return Handle404(c)
+	} else if errors.As(err, &fe) && (fe.Code == fiber.StatusUnauthorized || fe.Code == fiber.StatusForbidden) {
+		// Redirecting back would hide a denied request behind a 302.
+		return c.Status(fe.Code).SendString(fe.Message)
 	} else if err == fiber.ErrInternalServerError || util.IsErrNoRecords(err) {
 		return Handle500(c)
 	} else {
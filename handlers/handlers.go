@@ -0,0 +1,12 @@
+package handlers
+
+import "github.com/NikoMalik/GoTrack/data"
+
+// repos are the repositories the handlers work with.
+var repos *data.Repos
+
+// Init sets the repositories used by the handlers. Tests pass the in-memory
+// implementation of data/memory.
+func Init(r *data.Repos) {
+	repos = r
+}
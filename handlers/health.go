@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/db"
+	"github.com/NikoMalik/GoTrack/mail"
+	"github.com/NikoMalik/GoTrack/monitor"
+	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	readinessTimeout = 2 * time.Second
+	// mailQueueSaturation is the fill ratio of the mail queue above which
+	// the instance reports itself as not ready.
+	mailQueueSaturation = 0.9
+)
+
+// CheckResult is the status of a single dependency.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport is returned by the health endpoints.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+var readinessChecks = map[string]func(context.Context) error{
+	"db": func(ctx context.Context) error {
+		return db.Bun.PingContext(ctx)
+	},
+	"supabase": sb.Ping,
+	"scheduler": func(ctx context.Context) error {
+		if !monitor.Running() {
+			return errors.New("scheduler is not running")
+		}
+		return nil
+	},
+	"mail_queue": func(ctx context.Context) error {
+		n, size := mail.QueueLen()
+		if size > 0 && float64(n) >= float64(size)*mailQueueSaturation {
+			return errors.New("mail queue is saturated")
+		}
+		return nil
+	},
+}
+
+// HandleHealthz reports that the process is alive.
+func HandleHealthz(c *fiber.Ctx) error {
+	return c.JSON(HealthReport{Status: "ok"})
+}
+
+// HandleReadyz reports whether every dependency needed to serve traffic is
+// available. It responds with 503 if any check fails.
+func HandleReadyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), readinessTimeout)
+	defer cancel()
+
+	report := HealthReport{
+		Status: "ok",
+		Checks: make(map[string]CheckResult, len(readinessChecks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range readinessChecks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			res := CheckResult{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = "fail"
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if report.Status != "ok" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+	}
+	return c.JSON(report)
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// HandleVersion returns the build information of the binary.
+func HandleVersion(c *fiber.Ctx) error {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "build info not available"})
+	}
+
+	bi := BuildInfo{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Revision = s.Value
+		case "vcs.time":
+			bi.Time = s.Value
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+	return c.JSON(bi)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/NikoMalik/GoTrack/data"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// hostParams is the JSON body of the requests that create or change a
+// host. Empty fields are stored as NULL.
+type hostParams struct {
+	HostName      string
+	CanonicalName string
+	URL           string
+	IP            string
+	IPV6          string
+	Location      string
+	OS            string
+	// Active defaults to true for new hosts and is kept on updates.
+	Active *bool
+	Tags   []string
+}
+
+var hostSchema = v.Schema{
+	"hostName":      v.Rules(v.Required, v.Max(255)),
+	"canonicalName": v.Rules(v.Max(255)),
+}
+
+// HandleAPIPostHost creates a host from the JSON body and returns it.
+func HandleAPIPostHost(c *fiber.Ctx) error {
+	h := &data.Host{Active: 1}
+	if ok, err := bindHost(c, h); !ok {
+		return err
+	}
+	if err := repos.Hosts.Create(c.UserContext(), h); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(h)
+}
+
+// HandleAPIPutHost replaces the fields of a host with the JSON body and
+// returns it.
+func HandleAPIPutHost(c *fiber.Ctx) error {
+	h, err := apiHost(c)
+	if h == nil {
+		return err
+	}
+	if ok, err := bindHost(c, h); !ok {
+		return err
+	}
+	if err := repos.Hosts.Update(c.UserContext(), h); err != nil {
+		return err
+	}
+	return c.JSON(h)
+}
+
+// HandleAPIDeleteHost deletes a host together with its services.
+func HandleAPIDeleteHost(c *fiber.Ctx) error {
+	h, err := apiHost(c)
+	if h == nil {
+		return err
+	}
+	if err := repos.Hosts.Delete(c.UserContext(), h.ID); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// apiHost returns the host of the id in the path, in the account of the
+// request. It returns nil once it responded with 404 or failed.
+func apiHost(c *fiber.Ctx) (*data.Host, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "host not found"})
+	}
+	h, err := repos.Hosts.Get(c.UserContext(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "host not found"})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// bindHost validates the JSON body of c and copies it into h. Invalid
+// bodies get 422 with the errors by field, and false.
+func bindHost(c *fiber.Ctx, h *data.Host) (bool, error) {
+	var params hostParams
+	if err := json.Unmarshal(c.Body(), &params); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid JSON body"})
+	}
+	schema := hostSchema
+	if params.URL != "" {
+		schema = v.Merge(schema, v.Schema{"URL": v.Rules(v.URL)})
+	}
+	if errs, ok := v.Validate(&params, schema); !ok {
+		return false, c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"errors": errs})
+	}
+
+	h.HostName = params.HostName
+	h.CanonicalName = params.CanonicalName
+	if h.CanonicalName == "" {
+		h.CanonicalName = params.HostName
+	}
+	h.URL, h.IP, h.IPV6 = optional(params.URL), optional(params.IP), optional(params.IPV6)
+	h.Location, h.OS = optional(params.Location), optional(params.OS)
+	if params.Active != nil {
+		h.Active = 0
+		if *params.Active {
+			h.Active = 1
+		}
+	}
+	h.Tags = params.Tags
+	return true, nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestAPIWriteHosts(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+	middleware.Init(repos.Sessions, repos.APIKeys)
+	ctx := context.Background()
+	acc, err := repos.Accounts.Create(ctx, &supabase.User{ID: "u1", Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, secret := data.NewAPIKey(acc.ID, "ci", []string{string(data.PermHostsRead), string(data.PermHostsWrite)})
+	if err := repos.APIKeys.Create(ctx, k); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := repos.Accounts.Create(ctx, &supabase.User{ID: "u2", Email: "b@example.com"})
+	foreign := &data.Host{HostName: "other.example.com"}
+	if err := repos.Hosts.Create(data.WithAccount(ctx, other.ID), foreign); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(middleware.OptionalAuth, WithAccount)
+	api := app.Group("/api", middleware.RequireAuth)
+	hostsWrite := RequirePermission(data.PermHostsWrite)
+	api.Post("/hosts", hostsWrite, HandleAPIPostHost)
+	api.Put("/hosts/:id", hostsWrite, HandleAPIPutHost)
+	api.Delete("/hosts/:id", hostsWrite, HandleAPIDeleteHost)
+	do := func(method, target, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+secret)
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if status, _ := do("POST", "/api/hosts", `{"HostName": ""}`); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("create without a name: status %d", status)
+	}
+	status, body := do("POST", "/api/hosts", `{"HostName": "web.example.com", "URL": "https://web.example.com"}`)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create: status %d, body %s", status, body)
+	}
+	var h data.Host
+	if err := json.Unmarshal([]byte(body), &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.AccountID != acc.ID || h.CanonicalName != "web.example.com" || h.Active != 1 {
+		t.Errorf("created %+v", h)
+	}
+
+	target := "/api/hosts/" + strconv.Itoa(h.ID)
+	if status, body := do("PUT", target, `{"HostName": "www.example.com", "Active": false}`); status != fiber.StatusOK {
+		t.Fatalf("update: status %d, body %s", status, body)
+	}
+	got, err := repos.Hosts.Get(data.WithAccount(ctx, acc.ID), h.ID)
+	if err != nil || got.HostName != "www.example.com" || got.Active != 0 || got.URL != nil {
+		t.Errorf("updated %+v, %v", got, err)
+	}
+
+	// Hosts of other accounts don't exist for the key.
+	if status, _ := do("DELETE", "/api/hosts/"+strconv.Itoa(foreign.ID), ""); status != fiber.StatusNotFound {
+		t.Errorf("delete a host of another account: status %d", status)
+	}
+	if status, _ := do("DELETE", target, ""); status != fiber.StatusNoContent {
+		t.Errorf("delete: status %d", status)
+	}
+	if _, err := repos.Hosts.Get(data.WithAccount(ctx, acc.ID), h.ID); err == nil {
+		t.Errorf("host still there after delete")
+	}
+}
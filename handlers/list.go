@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetHosts renders the host list. htmx requests for a following page
+// get the rows only, so the list scrolls infinitely.
+func HandleGetHosts(c *fiber.Ctx) error {
+	page, q, err := listPage(c, data.HostSchema, repos.Hosts.List)
+	if err != nil {
+		return err
+	}
+	next := nextURL(c.Path(), q, page.Next)
+	if isScroll(c) {
+		return Render(c, layouts.HostRows(page.Items, next))
+	}
+	return Render(c, layouts.HostsIndex(listParams(q), page.Items, next))
+}
+
+// HandleGetServices renders the list of monitored host services.
+func HandleGetServices(c *fiber.Ctx) error {
+	page, q, err := listPage(c, data.HostServiceSchema, repos.HostServices.List)
+	if err != nil {
+		return err
+	}
+	next := nextURL(c.Path(), q, page.Next)
+	if isScroll(c) {
+		return Render(c, layouts.ServiceRows(page.Items, next))
+	}
+	return Render(c, layouts.ServicesIndex(listParams(q), page.Items, next))
+}
+
+// HandleGetEvents renders the monitoring events, newest first.
+func HandleGetEvents(c *fiber.Ctx) error {
+	page, q, err := listPage(c, data.EventSchema, repos.Events.List)
+	if err != nil {
+		return err
+	}
+	next := nextURL(c.Path(), q, page.Next)
+	if isScroll(c) {
+		return Render(c, layouts.EventRows(page.Items, next))
+	}
+	return Render(c, layouts.EventsIndex(listParams(q), page.Items, next))
+}
+
+// HandleAPIGetHosts returns a page of hosts as JSON.
+func HandleAPIGetHosts(c *fiber.Ctx) error {
+	return listJSON(c, data.HostSchema, repos.Hosts.List)
+}
+
+// HandleAPIGetServices returns a page of host services as JSON.
+func HandleAPIGetServices(c *fiber.Ctx) error {
+	return listJSON(c, data.HostServiceSchema, repos.HostServices.List)
+}
+
+// HandleAPIGetEvents returns a page of events as JSON.
+func HandleAPIGetEvents(c *fiber.Ctx) error {
+	return listJSON(c, data.EventSchema, repos.Events.List)
+}
+
+func listJSON[T any](c *fiber.Ctx, s *filter.Schema, list func(context.Context, filter.Spec) (filter.Page[T], error)) error {
+	page, _, err := listPage(c, s, list)
+	if err != nil {
+		return err
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return c.JSON(page)
+}
+
+// listPage reads the spec of a list endpoint from the query string and
+// returns the requested page together with the parsed query.
+func listPage[T any](c *fiber.Ctx, s *filter.Schema, list func(context.Context, filter.Spec) (filter.Page[T], error)) (filter.Page[T], url.Values, error) {
+	q, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return filter.Page[T]{}, q, fiber.NewError(fiber.StatusBadRequest, "invalid query string")
+	}
+	spec, err := s.Parse(q)
+	if err != nil {
+		return filter.Page[T]{}, q, listError(err)
+	}
+	page, err := list(c.UserContext(), spec)
+	if err != nil {
+		return page, q, listError(err)
+	}
+	return page, q, nil
+}
+
+// nextURL returns the URL of the page following the one selected by q, or
+// an empty string on the last page.
+func nextURL(path string, q url.Values, next string) string {
+	if next == "" {
+		return ""
+	}
+	v := url.Values{}
+	for k, vs := range q {
+		v[k] = vs
+	}
+	v.Set("after", next)
+	return path + "?" + v.Encode()
+}
+
+// listParams returns the filters of q without the cursor, for the filter
+// form and the links of a list page.
+func listParams(q url.Values) url.Values {
+	v := url.Values{}
+	for k, vs := range q {
+		if k != "after" {
+			v[k] = vs
+		}
+	}
+	return v
+}
+
+// isScroll reports whether c asks for the rows of a following page.
+func isScroll(c *fiber.Ctx) bool {
+	return c.Get("HX-Request") != "" && c.Query("after") != ""
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestHandleAPIGetHosts(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+	acc, err := repos.Accounts.Create(context.Background(), &supabase.User{ID: "u1", Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hosts of other accounts must not show up.
+	store.Hosts[100] = &data.Host{ID: 100, AccountID: acc.ID + 1, HostName: "host9.example.com", Tags: []string{"prod"}}
+	for i := 1; i <= 5; i++ {
+		tags := []string{"staging"}
+		if i%2 == 1 {
+			tags = []string{"prod", "eu"}
+		}
+		store.Hosts[i] = &data.Host{ID: i, AccountID: acc.ID, HostName: fmt.Sprintf("host%d.example.com", i), Tags: tags}
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, &data.AuthenticatedUser{ID: "u1", LoggedIn: true})
+		return c.Next()
+	}, WithAccount)
+	app.Get("/api/hosts", HandleAPIGetHosts)
+
+	get := func(q url.Values) (int, filter.Page[data.Host]) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/hosts?"+q.Encode(), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page filter.Page[data.Host]
+		if resp.StatusCode == fiber.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, page
+	}
+
+	q := url.Values{"tag": {"prod"}, "sort": {"-host_name"}, "limit": {"2"}}
+	var names []string
+	for {
+		status, page := get(q)
+		if status != fiber.StatusOK {
+			t.Fatalf("status = %d", status)
+		}
+		for _, h := range page.Items {
+			names = append(names, h.HostName)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Set("after", page.Next)
+	}
+	want := fmt.Sprint([]string{"host5.example.com", "host3.example.com", "host1.example.com"})
+	if fmt.Sprint(names) != want {
+		t.Errorf("hosts = %v, want %v", names, want)
+	}
+
+	if status, _ := get(url.Values{"sort": {"ip"}}); status != fiber.StatusBadRequest {
+		t.Errorf("sorting on an unlisted column: status = %d, want 400", status)
+	}
+}
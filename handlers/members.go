@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/middleware"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+// accountCookie holds the id of the account the user works in.
+const accountCookie = "account"
+
+var inviteSchema = v.Schema{
+	"email": v.Rules(v.Email),
+	"role":  v.Rules(v.In(roleNames())),
+}
+
+func roleNames() []string {
+	names := make([]string, len(data.Roles))
+	for i, r := range data.Roles {
+		names[i] = r.String()
+	}
+	return names
+}
+
+// WithAccount scopes the request of a signed in user to the account they
+// work in: the one selected with the account cookie, or their oldest
+// membership. Users without any membership get an account of their own.
+// Requests made with an API key work in the account of the key.
+func WithAccount(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	if user == nil || !user.LoggedIn {
+		return c.Next()
+	}
+	if k := middleware.APIKey(c); k != nil {
+		return withKeyAccount(c, user, k)
+	}
+	ctx := c.UserContext()
+	ms, err := repos.Members.Memberships(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(ms) == 0 {
+		if _, err := repos.Accounts.FirstOrCreate(ctx, &supabase.User{ID: user.ID, Email: user.Email}); err != nil {
+			return err
+		}
+		if ms, err = repos.Members.Memberships(ctx, user.ID); err != nil {
+			return err
+		}
+		if len(ms) == 0 {
+			return fiber.ErrInternalServerError
+		}
+	}
+
+	m := &ms[0]
+	if id, err := strconv.ParseInt(c.Cookies(accountCookie), 10, 64); err == nil {
+		for i := range ms {
+			if ms[i].AccountID == id {
+				m = &ms[i]
+			}
+		}
+	}
+	c.Locals("membership", m)
+	user.AccessLevel = m.AccessLevel
+	c.SetUserContext(data.WithAccount(ctx, m.AccountID))
+	logEvent.SetCtx(c, logEvent.FromCtx(c).With("account_id", m.AccountID))
+	if ok, err := requireTwoFactor(c, user, m); !ok {
+		return err
+	}
+	return c.Next()
+}
+
+// currentMembership returns the membership WithAccount selected.
+func currentMembership(c *fiber.Ctx) *data.Membership {
+	m, _ := c.Locals("membership").(*data.Membership)
+	return m
+}
+
+// HandleGetMembers renders the members and invitations of the account and
+// the invitations waiting for the user.
+func HandleGetMembers(c *fiber.Ctx) error {
+	return renderMembers(c, layouts.InviteParams{}, nil)
+}
+
+func renderMembers(c *fiber.Ctx, params layouts.InviteParams, errs v.Errors) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	if user == nil || m == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	ctx := c.UserContext()
+	page := layouts.MembersPage{Current: m, Invite: params, Errors: errs}
+	var err error
+	if page.Accounts, err = repos.Members.Memberships(ctx, user.ID); err != nil {
+		return err
+	}
+	if page.Members, err = repos.Members.List(ctx, m.AccountID); err != nil {
+		return err
+	}
+	if page.Invitations, err = repos.Members.Invitations(ctx, m.AccountID); err != nil {
+		return err
+	}
+	if page.Received, err = repos.Members.InvitationsFor(ctx, user.Email); err != nil {
+		return err
+	}
+	return Render(c, layouts.MembersIndex(page))
+}
+
+// HandlePostInvite invites an email address to the account with a role no
+// higher than the role of the inviting user.
+func HandlePostInvite(c *fiber.Ctx) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	params := layouts.InviteParams{
+		Email: c.FormValue("email"),
+		Role:  c.FormValue("role", data.RoleViewer.String()),
+	}
+	if errs, ok := v.Validate(&params, inviteSchema); !ok {
+		return renderMembers(c, params, errs)
+	}
+	role, _ := data.ParseRole(params.Role)
+	if m == nil || !m.AccessLevel.Grants(role) {
+		return deny(c, data.PermMembersWrite)
+	}
+
+	inv := &data.Invitation{
+		AccountID:   m.AccountID,
+		Email:       params.Email,
+		AccessLevel: role,
+		InvitedBy:   user.ID,
+	}
+	name := ""
+	if m.Account != nil {
+		name = m.Account.Name
+	}
+	err := repos.Tx.InTx(c.UserContext(), func(ctx context.Context, r *data.Repos) error {
+		if err := r.Members.Invite(ctx, inv); err != nil {
+			return err
+		}
+		return r.Publisher.Publish(ctx, data.InvitationCreatedEvent, data.InvitationCreated{
+			Invitation:   *inv,
+			AccountName:  name,
+			InviterEmail: user.Email,
+			URL:          c.BaseURL() + "/account/members",
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return HXRedirect(c, "/account/members")
+}
+
+// HandlePostRemoveMember removes a member from the account. Anyone may
+// leave, removing others takes members:write and a role at least as high as
+// theirs.
+func HandlePostRemoveMember(c *fiber.Ctx) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	if user == nil || m == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	userID := c.Params("userID")
+	if userID != user.ID {
+		if err := checkGrants(c, m, userID); err != nil {
+			return err
+		}
+	}
+	err := repos.Members.Remove(c.UserContext(), m.AccountID, userID)
+	switch {
+	case errors.Is(err, data.ErrLastOwner):
+		return fiber.NewError(fiber.StatusBadRequest, "the last owner can't leave the account")
+	case errors.Is(err, sql.ErrNoRows):
+		return fiber.ErrNotFound
+	case err != nil:
+		return err
+	}
+	if userID == user.ID {
+		c.ClearCookie(accountCookie)
+		return HXRedirect(c, "/")
+	}
+	return HXRedirect(c, "/account/members")
+}
+
+// HandlePostSetRole changes the role of a member. Users can neither hand
+// out nor take away a role higher than their own.
+func HandlePostSetRole(c *fiber.Ctx) error {
+	m := currentMembership(c)
+	role, err := data.ParseRole(c.FormValue("role"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown role")
+	}
+	userID := c.Params("userID")
+	if m == nil || !m.AccessLevel.Grants(role) {
+		return deny(c, data.PermMembersWrite)
+	}
+	if err := checkGrants(c, m, userID); err != nil {
+		return err
+	}
+	err = repos.Members.SetRole(c.UserContext(), m.AccountID, userID, role)
+	switch {
+	case errors.Is(err, data.ErrLastOwner):
+		return fiber.NewError(fiber.StatusBadRequest, "the last owner can't be demoted")
+	case errors.Is(err, sql.ErrNoRows):
+		return fiber.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return HXRedirect(c, "/account/members")
+}
+
+// checkGrants denies the request unless m may manage the member userID, whose
+// role must not be higher than the role of m.
+func checkGrants(c *fiber.Ctx, m *data.Membership, userID string) error {
+	ms, err := repos.Members.List(c.UserContext(), m.AccountID)
+	if err != nil {
+		return err
+	}
+	for _, other := range ms {
+		if other.UserID == userID {
+			if !m.AccessLevel.Grants(other.AccessLevel) {
+				return deny(c, data.PermMembersWrite)
+			}
+			return nil
+		}
+	}
+	return fiber.ErrNotFound
+}
+
+// HandlePostRevokeInvitation deletes a pending invitation of the account.
+func HandlePostRevokeInvitation(c *fiber.Ctx) error {
+	m := currentMembership(c)
+	if !can(c, data.PermMembersWrite) {
+		return deny(c, data.PermMembersWrite)
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	err = repos.Members.Revoke(c.UserContext(), m.AccountID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return HXRedirect(c, "/account/members")
+}
+
+// HandlePostAcceptInvitation makes the user a member of the account they
+// were invited to and switches to it.
+func HandlePostAcceptInvitation(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	if user == nil || !user.LoggedIn {
+		return HXRedirect(c, "/auth/login")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	m, err := repos.Members.Accept(c.UserContext(), id, user.ID, user.Email)
+	if errors.Is(err, data.ErrInvitation) {
+		return fiber.NewError(fiber.StatusBadRequest, "the invitation is no longer valid")
+	}
+	if err != nil {
+		return err
+	}
+	setAccountCookie(c, m.AccountID)
+	return HXRedirect(c, "/account/members")
+}
+
+// HandlePostSwitchAccount selects the account the user works in.
+func HandlePostSwitchAccount(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	if user == nil || !user.LoggedIn {
+		return HXRedirect(c, "/auth/login")
+	}
+	id, err := strconv.ParseInt(c.FormValue("account_id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid account")
+	}
+	ms, err := repos.Members.Memberships(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if m.AccountID == id {
+			setAccountCookie(c, id)
+			// Back to the page the switch was made on.
+			return HXRedirect(c, localPath(c, c.Get(fiber.HeaderReferer)))
+		}
+	}
+	return fiber.ErrForbidden
+}
+
+func setAccountCookie(c *fiber.Ctx, accountID int64) {
+	c.Cookie(&fiber.Cookie{
+		Name:     accountCookie,
+		Value:    strconv.FormatInt(accountID, 10),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/filter"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestInvitationSharesHosts(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+
+	users := map[string]*data.AuthenticatedUser{
+		"owner": {ID: "u1", Email: "owner@example.com", LoggedIn: true},
+		"guest": {ID: "u2", Email: "guest@example.com", LoggedIn: true},
+	}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, users[c.Get("X-User")])
+		return c.Next()
+	}, WithAccount)
+	app.Get("/api/hosts", HandleAPIGetHosts)
+	app.Post("/account/members/invite", HandlePostInvite)
+	app.Post("/account/invitations/:id/accept", HandlePostAcceptInvitation)
+	app.Post("/account/members/:userID/role", HandlePostSetRole)
+	app.Post("/account/members/:userID/remove", HandlePostRemoveMember)
+
+	do := func(user, method, target, body, cookie string) *httptestResponse {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-User", user)
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		if cookie != "" {
+			req.Header.Set(fiber.HeaderCookie, cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return &httptestResponse{status: resp.StatusCode, cookies: resp.Header.Values(fiber.HeaderSetCookie), body: string(b)}
+	}
+
+	// The first request creates the owner's account.
+	do("owner", "GET", "/api/hosts", "", "")
+	ms, _ := repos.Members.Memberships(context.Background(), "u1")
+	if len(ms) != 1 || ms[0].AccessLevel != data.RoleOwner {
+		t.Fatalf("owner memberships = %+v", ms)
+	}
+	accountID := ms[0].AccountID
+	if err := repos.Hosts.Create(data.WithAccount(context.Background(), accountID), &data.Host{HostName: "shared.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := do("owner", "POST", "/account/members/invite", "email=guest@example.com", ""); r.status != fiber.StatusFound {
+		t.Fatalf("invite: status = %d", r.status)
+	}
+	invs, _ := repos.Members.InvitationsFor(context.Background(), "guest@example.com")
+	if len(invs) != 1 || len(store.Published) != 1 || store.Published[0].Topic != data.InvitationCreatedEvent {
+		t.Fatalf("invitations = %+v, published = %+v", invs, store.Published)
+	}
+
+	accept := "/account/invitations/" + strconv.FormatInt(invs[0].ID, 10) + "/accept"
+	if r := do("owner", "POST", accept, "", ""); r.status != fiber.StatusBadRequest {
+		t.Errorf("accept by someone else: status = %d, want 400", r.status)
+	}
+	r := do("guest", "POST", accept, "", "")
+	if r.status != fiber.StatusFound || len(r.cookies) == 0 {
+		t.Fatalf("accept: status = %d, cookies = %v", r.status, r.cookies)
+	}
+	cookie := strings.SplitN(r.cookies[0], ";", 2)[0]
+	if cookie != accountCookie+"="+strconv.FormatInt(accountID, 10) {
+		t.Errorf("cookie = %q", cookie)
+	}
+	if r := do("guest", "GET", "/api/hosts", "", cookie); !strings.Contains(r.body, "shared.example.com") {
+		t.Errorf("guest hosts = %s, want the shared host", r.body)
+	}
+	if r := do("guest", "GET", "/api/hosts", "", ""); strings.Contains(r.body, "shared.example.com") {
+		t.Errorf("guest's own account shows the shared host")
+	}
+	if r := do("guest", "POST", "/account/members/invite", "email=other@example.com", cookie); r.status != fiber.StatusForbidden {
+		t.Errorf("invite by a viewer: status = %d, want 403", r.status)
+	}
+	denied, _ := repos.Audit.List(context.Background(), data.AuditScope{AccountID: accountID}, filter.Spec{
+		Where: []filter.Cond{filter.Where("action", filter.Eq, data.AuditPermissionDenied)},
+	})
+	if len(denied.Items) != 1 {
+		t.Errorf("denied requests audited = %d, want 1", len(denied.Items))
+	}
+	if r := do("owner", "POST", "/account/members/u2/role", "role=admin", ""); r.status != fiber.StatusFound {
+		t.Errorf("set role: status = %d", r.status)
+	}
+	if r := do("guest", "POST", "/account/members/u1/role", "role=viewer", cookie); r.status != fiber.StatusForbidden {
+		t.Errorf("admin demoting the owner: status = %d, want 403", r.status)
+	}
+
+	if r := do("owner", "POST", "/account/members/u1/remove", "", ""); r.status != fiber.StatusBadRequest {
+		t.Errorf("removing the last owner: status = %d, want 400", r.status)
+	}
+	if r := do("owner", "POST", "/account/members/u2/remove", "", ""); r.status != fiber.StatusFound {
+		t.Errorf("remove: status = %d", r.status)
+	}
+	ms, _ = repos.Members.Memberships(context.Background(), "u2")
+	for _, m := range ms {
+		if m.AccountID == accountID {
+			t.Errorf("guest is still a member")
+		}
+	}
+}
+
+type httptestResponse struct {
+	status  int
+	cookies []string
+	body    string
+}
+
+func TestConcurrentFirstRequestsCreateOneAccount(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, &data.AuthenticatedUser{ID: "u1", Email: "a@example.com", LoggedIn: true})
+		return c.Next()
+	}, WithAccount)
+	app.Get("/api/hosts", HandleAPIGetHosts)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := app.Test(httptest.NewRequest("GET", "/api/hosts", nil)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(store.Accounts) != 1 {
+		t.Errorf("%d accounts created, want 1", len(store.Accounts))
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(localPath(c, c.Query("ref")))
+	})
+	for ref, want := range map[string]string{
+		"":                             "/",
+		"/hosts?sort=-name":            "/hosts?sort=-name",
+		"http://example.com/events":    "/events",
+		"https://evil.com/hosts":       "/",
+		"//evil.com/hosts":             "/",
+		"/\\evil.com":                  "/",
+		"javascript:alert(1)":          "/",
+		"http://example.com.evil.com/": "/",
+	} {
+		req := httptest.NewRequest("GET", "http://example.com/?ref="+url.QueryEscape(ref), nil)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := io.ReadAll(resp.Body); string(b) != want {
+			t.Errorf("localPath(%q) = %q, want %q", ref, b, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/a-h/templ"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+const (
+	// oauthCookie keeps the provider, state and PKCE verifier of a sign in
+	// until the callback.
+	oauthCookie = "oauth"
+	oauthTTL    = 10 * time.Minute
+)
+
+// errEmailTaken is returned when an OAuth sign in uses the address of an
+// account Supabase didn't link it to, because the address isn't verified.
+var errEmailTaken = errors.New("an account with this email address exists")
+
+// signInWithProvider sends the user to the provider. The callback has to
+// present the state kept in a cookie, and the code is exchanged with the
+// verifier kept next to it.
+func signInWithProvider(c *fiber.Ctx, provider string) error {
+	if !slices.Contains(config.Get().Auth.Providers(), provider) {
+		return fiber.ErrNotFound
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+
+	resp, err := sb.Client.Auth.SignInWithProvider(supabase.ProviderSignInOptions{
+		Provider:   provider,
+		RedirectTo: config.Get().HTTP.BaseURL + "/auth/callback?state=" + url.QueryEscape(state),
+		FlowType:   supabase.PKCE,
+	})
+	if err != nil {
+		logEvent.FromCtx(c).Error("oauth sign in", "provider", provider, "error", err)
+		return err
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthCookie,
+		Value:    provider + "." + state + "." + resp.CodeVerifier,
+		Path:     "/auth/callback",
+		MaxAge:   int(oauthTTL.Seconds()),
+		Secure:   true,
+		HTTPOnly: true,
+		// The callback is a redirect from another site, which doesn't
+		// carry strict cookies.
+		SameSite: "Lax",
+	})
+	return HXRedirect(c, resp.URL)
+}
+
+func HandleSignInWithGoogle(c *fiber.Ctx) error {
+	return signInWithProvider(c, "google")
+}
+
+func HandleSignInWithGithub(c *fiber.Ctx) error {
+	return signInWithProvider(c, "github")
+}
+
+// HandleAuthCallback completes an OAuth sign in: it checks the state,
+// exchanges the code for tokens and links the identity to the local user.
+func HandleAuthCallback(c *fiber.Ctx) error {
+	l := logEvent.FromCtx(c)
+	cookie := c.Cookies(oauthCookie)
+	c.Cookie(&fiber.Cookie{Name: oauthCookie, Path: "/auth/callback", Expires: time.Unix(0, 0), Secure: true, HTTPOnly: true})
+
+	if e := c.Query("error"); e != "" {
+		l.Warn("oauth callback", "error", e, "description", c.Query("error_description"))
+		return oauthFailed(c, "The sign in was cancelled or denied.")
+	}
+	provider, state, verifier := splitOAuthCookie(cookie)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		l.Warn("oauth callback with an unknown state")
+		return oauthFailed(c, "The sign in expired. Please try again.")
+	}
+	details, err := sb.Client.Auth.ExchangeCode(c.UserContext(), supabase.ExchangeCodeOpts{
+		AuthCode:     c.Query("code"),
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		l.Warn("oauth code exchange", "provider", provider, "error", err)
+		return oauthFailed(c, "The sign in could not be completed. Please try again.")
+	}
+
+	err = linkIdentity(c, provider, &details.User)
+	if errors.Is(err, errEmailTaken) {
+		return oauthFailed(c, "An account with this email address exists. Log in with your password and verify your address first.")
+	}
+	if err != nil {
+		return err
+	}
+	return signIn(c, details)
+}
+
+// linkIdentity records the identity of user at provider. Supabase signs
+// identities with the verified address of an existing user in as that
+// user, so they are linked to it. New users get a local user and an
+// account.
+func linkIdentity(c *fiber.Ctx, provider string, user *supabase.User) error {
+	ctx := c.UserContext()
+	subject := metadata(user, "provider_id", "sub")
+	if subject == "" {
+		subject = user.ID
+	}
+	id, err := repos.Identities.Get(ctx, provider, subject)
+	if err == nil {
+		if id.UserID != user.ID {
+			return errEmailTaken
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = repos.Users.Get(ctx, user.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Supabase made a new user. An address that belongs to another
+		// user means the other user never verified it.
+		if _, err := repos.Users.GetByEmail(ctx, user.Email); err == nil {
+			return errEmailTaken
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		now := time.Now()
+		if err := repos.Users.Create(ctx, &data.User{
+			ID:              user.ID,
+			Name:            metadata(user, "full_name", "name", "user_name"),
+			Email:           user.Email,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			EmailVerifiedAt: sql.NullTime{Time: now, Valid: true},
+		}); err != nil {
+			return err
+		}
+		if _, err := repos.Accounts.Create(ctx, user); err != nil {
+			return err
+		}
+		audit(c, user.ID, user.Email, data.AuditRecord{
+			Action:     data.AuditSignup,
+			TargetType: "user",
+			TargetID:   user.ID,
+		})
+	case err != nil:
+		return err
+	}
+	return repos.Identities.Link(ctx, &data.Identity{
+		Provider: provider,
+		Subject:  subject,
+		UserID:   user.ID,
+		Email:    user.Email,
+	})
+}
+
+// metadata returns the first of keys set in the metadata of user.
+func metadata(user *supabase.User, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := user.UserMetadata[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func splitOAuthCookie(v string) (provider, state, verifier string) {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) != 3 {
+		return "", "", ""
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+func oauthFailed(c *fiber.Ctx, message string) error {
+	return Render(c, layouts.OAuthFailed(message), templ.WithStatus(fiber.StatusBadRequest))
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestOAuthCallback(t *testing.T) {
+	store := memory.NewStore()
+	Init(memory.NewRepos(store))
+	ctx := context.Background()
+	if err := repos.Users.Create(ctx, &data.User{ID: "u1", Email: "ann@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var user *supabase.User
+	app := fiber.New()
+	app.Get("/auth/callback", HandleAuthCallback)
+	app.Get("/link", func(c *fiber.Ctx) error {
+		return linkIdentity(c, "github", user)
+	})
+	link := func(u supabase.User) error {
+		t.Helper()
+		user = &u
+		resp, err := app.Test(httptest.NewRequest("GET", "/link", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			return errors.New(resp.Status)
+		}
+		return nil
+	}
+
+	// Callbacks without the state of the sign in are refused.
+	req := httptest.NewRequest("GET", "/auth/callback?state=forged&code=c", nil)
+	req.AddCookie(&http.Cookie{Name: oauthCookie, Value: "github.state.verifier"})
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("forged state: %v %v", resp.StatusCode, err)
+	}
+
+	// Supabase linked the identity to the existing user.
+	meta := map[string]interface{}{"provider_id": "42"}
+	if err := link(supabase.User{ID: "u1", Email: "ann@example.com", UserMetadata: meta}); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := repos.Identities.Get(ctx, "github", "42"); err != nil || id.UserID != "u1" {
+		t.Errorf("identity %+v, %v", id, err)
+	}
+	if err := link(supabase.User{ID: "u1", Email: "ann@example.com", UserMetadata: meta}); err != nil {
+		t.Errorf("second sign in: %v", err)
+	}
+
+	// A new user gets a local user and an account.
+	if err := link(supabase.User{ID: "u2", Email: "bob@example.com", UserMetadata: map[string]interface{}{"provider_id": "43"}}); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := repos.Users.Get(ctx, "u2"); err != nil || !u.EmailVerifiedAt.Valid {
+		t.Errorf("new user %+v, %v", u, err)
+	}
+	if _, err := repos.Accounts.GetByUserID(ctx, "u2"); err != nil {
+		t.Errorf("account of new user: %v", err)
+	}
+
+	// An unverified address of another user isn't taken over.
+	if err := link(supabase.User{ID: "u3", Email: "ann@example.com", UserMetadata: map[string]interface{}{"provider_id": "44"}}); err == nil {
+		t.Error("identity linked to the address of another user")
+	}
+	if _, err := repos.Users.Get(ctx, "u3"); err == nil {
+		t.Error("created a second user with the address")
+	}
+}
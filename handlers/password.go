@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/NikoMalik/GoTrack/sb"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/a-h/templ"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nedpals/supabase-go"
+)
+
+// passwordSchema returns the rules of a new password: those of signup,
+// and a confirmation matching it.
+func passwordSchema(password string) v.Schema {
+	return v.Schema{
+		"password":             signupSchema["password"],
+		"passwordConfirmation": v.Rules(v.EQ(password).Message("does not match the password")),
+	}
+}
+
+func HandleGetForgotPassword(c *fiber.Ctx) error {
+	return Render(c, layouts.ForgotPasswordIndex())
+}
+
+// HandlePostForgotPassword mails a reset link to the address in the form.
+// Like resending a verification, the response doesn't tell whether the
+// address belongs to an account.
+func HandlePostForgotPassword(c *fiber.Ctx) error {
+	var params layouts.ForgotPasswordParams
+	errs, ok := v.Request(c.Context(), &params, v.Schema{"email": signupSchema["email"]})
+	if !ok {
+		return Render(c, layouts.ForgotPasswordForm(params, errs))
+	}
+	done := layouts.Toast("Password reset", "If the address belongs to an account, a reset link is on its way.")
+
+	l := logEvent.FromCtx(c)
+	ctx := c.UserContext()
+	user, err := repos.Users.GetByEmail(ctx, params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Render(c, done)
+	}
+	if err != nil {
+		return err
+	}
+	reset, token := data.NewPasswordReset(user.ID, config.Get().Auth.PasswordResetTTL)
+	var created bool
+	err = repos.Tx.InTx(ctx, func(ctx context.Context, r *data.Repos) error {
+		ok, err := r.Resets.Create(ctx, reset, config.Get().Auth.PasswordResetInterval)
+		if err != nil || !ok {
+			return err
+		}
+		created = true
+		return r.Publisher.Publish(ctx, data.PasswordResetEvent, data.PasswordResetRequested{
+			Email:     user.Email,
+			Name:      user.Name,
+			URL:       config.Get().HTTP.BaseURL + "/auth/reset?token=" + url.QueryEscape(token),
+			ExpiresAt: reset.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if !created {
+		l.Info("password reset email rate limited", "id", user.ID)
+		return Render(c, done)
+	}
+	l.Info("password reset email sent", "id", user.ID)
+	return Render(c, done)
+}
+
+// HandleGetResetPassword shows the form of a reset link.
+func HandleGetResetPassword(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if _, err := repos.Resets.Get(c.UserContext(), data.PasswordResetID(token)); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return Render(c, layouts.ResetPasswordInvalid(), templ.WithStatus(fiber.StatusBadRequest))
+	}
+	return Render(c, layouts.ResetPasswordIndex(token))
+}
+
+// HandlePostResetPassword sets the password of a reset link and signs the
+// user out everywhere, here and in Supabase.
+func HandlePostResetPassword(c *fiber.Ctx) error {
+	var params layouts.ResetPasswordParams
+	errs, ok := v.Request(c.Context(), &params, passwordSchema(c.FormValue("password")))
+	if !ok {
+		return Render(c, layouts.ResetPasswordForm(params.Token, errs))
+	}
+
+	l := logEvent.FromCtx(c)
+	ctx := c.UserContext()
+	reset, err := repos.Resets.Use(ctx, data.PasswordResetID(params.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Render(c, layouts.Toast("Password reset", "This link has expired or was already used. Request a new one."))
+	}
+	if err != nil {
+		return err
+	}
+	if err := sb.SetPassword(ctx, reset.UserID, params.Password); err != nil {
+		l.Error("reset password", "id", reset.UserID, "error", err)
+		return Render(c, layouts.Toast("Password reset", "The password could not be changed. Request a new link and try again."))
+	}
+	if err := repos.Sessions.RevokeAll(ctx, reset.UserID, ""); err != nil {
+		return err
+	}
+	// Refresh tokens taken from a session before the reset stop working.
+	if user, err := repos.Users.Get(ctx, reset.UserID); err != nil {
+		l.Error("reset password: sign out", "id", reset.UserID, "error", err)
+	} else if err := sb.LogoutEverywhere(ctx, user.Email, params.Password); err != nil {
+		l.Error("reset password: sign out", "id", reset.UserID, "error", err)
+	}
+	audit(c, reset.UserID, "", data.AuditRecord{
+		Action:     data.AuditPasswordReset,
+		TargetType: "user",
+		TargetID:   reset.UserID,
+	})
+	l.Info("password reset", "id", reset.UserID)
+
+	if err := middleware.EndSession(c); err != nil {
+		return err
+	}
+	return HXRedirect(c, "/auth/login")
+}
+
+func HandleGetChangePassword(c *fiber.Ctx) error {
+	return Render(c, layouts.ChangePasswordIndex())
+}
+
+// HandlePostChangePassword changes the password of the user after checking
+// the current one, and signs the other sessions out.
+func HandlePostChangePassword(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	var params layouts.ChangePasswordParams
+	schema := v.Merge(passwordSchema(c.FormValue("password")), v.Schema{"currentPassword": v.Rules(v.Required)})
+	errs, ok := v.Request(c.Context(), &params, schema)
+	if !ok {
+		return Render(c, layouts.ChangePasswordForm(errs))
+	}
+
+	l := logEvent.FromCtx(c)
+	ctx := c.UserContext()
+	details, err := sb.Client.Auth.SignIn(ctx, supabase.UserCredentials{
+		Email:    user.Email,
+		Password: params.CurrentPassword,
+	})
+	if err != nil {
+		l.Warn("change password: current password", "id", user.ID, "error", err)
+		errs.Add("currentPassword", "is not correct")
+		return Render(c, layouts.ChangePasswordForm(errs))
+	}
+	_, err = sb.Client.Auth.UpdateUser(ctx, details.AccessToken, map[string]any{"password": params.Password})
+	// Checking the current password signed in once more, that session
+	// is of no use to anybody.
+	if err := sb.Logout(ctx, details.AccessToken, sb.LogoutLocal); err != nil {
+		l.Error("change password: sign out", "id", user.ID, "error", err)
+	}
+	if err != nil {
+		l.Error("change password", "id", user.ID, "error", err)
+		return Render(c, layouts.Toast("Password", "The password could not be changed, please try again."))
+	}
+
+	current := ""
+	if sess := middleware.CurrentSession(c); sess != nil {
+		current = sess.ID
+	}
+	if err := repos.Sessions.RevokeAll(ctx, user.ID, current); err != nil {
+		return err
+	}
+	audit(c, "", "", data.AuditRecord{
+		Action:     data.AuditPasswordChange,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+	return Render(c, layouts.Toast("Password", "Your password is changed and your other sessions are signed out."))
+}
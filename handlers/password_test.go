@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestResetPassword(t *testing.T) {
+	Init(memory.NewRepos(memory.NewStore()))
+	reset, token := data.NewPasswordReset("u1", time.Hour)
+	if ok, err := repos.Resets.Create(context.Background(), reset, time.Minute); err != nil || !ok {
+		t.Fatalf("Create = %v, %v", ok, err)
+	}
+	// Another link is only sent after the interval.
+	again, _ := data.NewPasswordReset("u1", time.Hour)
+	if ok, err := repos.Resets.Create(context.Background(), again, time.Minute); err != nil || ok {
+		t.Errorf("second reset within the interval: Create = %v, %v", ok, err)
+	}
+
+	app := fiber.New()
+	app.Get("/auth/reset", HandleGetResetPassword)
+	app.Post("/auth/reset", HandlePostResetPassword)
+	do := func(method, target string, form url.Values) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if status, _ := do("GET", "/auth/reset?token="+token, nil); status != fiber.StatusOK {
+		t.Errorf("valid link: status %d", status)
+	}
+	if status, _ := do("GET", "/auth/reset?token=guess", nil); status != fiber.StatusBadRequest {
+		t.Errorf("unknown link: status %d", status)
+	}
+
+	// The new password follows the signup rules and must be confirmed.
+	params := layouts.ResetPasswordParams{Password: "Secret!1", PasswordConfirmation: "Secret!2"}
+	if errs, ok := v.Validate(&params, passwordSchema(params.Password)); ok || !errs.Has("passwordConfirmation") {
+		t.Errorf("mismatched confirmation: errors %v", errs)
+	}
+	params = layouts.ResetPasswordParams{Password: "secret", PasswordConfirmation: "secret"}
+	if errs, ok := v.Validate(&params, passwordSchema(params.Password)); ok || !errs.Has("password") {
+		t.Errorf("weak password: errors %v", errs)
+	}
+	do("POST", "/auth/reset", url.Values{
+		"token":                {token},
+		"password":             {"Secret!1"},
+		"passwordConfirmation": {"Secret!2"},
+	})
+	if _, err := repos.Resets.Get(context.Background(), reset.ID); err != nil {
+		t.Errorf("invalid form used the link: %v", err)
+	}
+
+	// A link works once.
+	if _, err := repos.Resets.Use(context.Background(), reset.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Resets.Use(context.Background(), reset.ID); err == nil {
+		t.Error("reset link used twice")
+	}
+	if status, _ := do("GET", "/auth/reset?token="+token, nil); status != fiber.StatusBadRequest {
+		t.Errorf("used link: status %d", status)
+	}
+}
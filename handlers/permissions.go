@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission only lets signed in users whose role in the current
+// account grants p through. Anyone else gets 403, which is written to the
+// audit log. It has to run after WithAccount.
+func RequirePermission(p data.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := getAuthenticatedUser(c)
+		if user == nil || !user.LoggedIn {
+			return HXRedirect(c, "/auth/login")
+		}
+		if !can(c, p) {
+			return deny(c, p)
+		}
+		return c.Next()
+	}
+}
+
+// can reports whether the user may do p in the account of the request.
+// Requests made with an API key are limited to its scopes as well.
+func can(c *fiber.Ctx, p data.Permission) bool {
+	m := currentMembership(c)
+	if k := middleware.APIKey(c); k != nil && !k.Allows(p) {
+		return false
+	}
+	return m != nil && m.AccessLevel.Can(p)
+}
+
+// deniedRequest is what the audit log records of a denied request.
+type deniedRequest struct {
+	Permission data.Permission
+	Method     string
+	Path       string
+}
+
+// deny audits a request that lacks p and fails it with 403.
+func deny(c *fiber.Ctx, p data.Permission) error {
+	rec := data.AuditRecord{
+		Action:     data.AuditPermissionDenied,
+		TargetType: "route",
+		TargetID:   c.Route().Path,
+		After:      deniedRequest{Permission: p, Method: c.Method(), Path: c.Path()},
+	}
+	if m := currentMembership(c); m != nil {
+		rec.AccountID = &m.AccountID
+	}
+	audit(c, "", "", rec)
+	return fiber.ErrForbidden
+}
@@ -1,26 +1,12 @@
 package handlers
 
 import (
-	"os"
-
+	"github.com/NikoMalik/GoTrack/config"
 	"github.com/NikoMalik/GoTrack/views/layouts"
 	"github.com/gofiber/fiber/v2"
 )
 
 func HandleGetHome(c *fiber.Ctx) error {
-	// accessToken := c.Query("access_Token")
-	// if len(accessToken) == 0 {
-	// 	Render(c, layouts.CallbackScript())
-	// 	log.Println("no access token")
-	// 	return c.Redirect("/auth/callback/" + accessToken)
-	// }
-
-	// if len(accessToken) > 0 {
-
-	// 	setAuthCookie(c, accessToken)
-
-	// }
-
 	if err := Render(c, layouts.App()); err != nil {
 		return err
 	}
@@ -30,10 +16,11 @@ func HandleGetHome(c *fiber.Ctx) error {
 }
 
 func HandlePricing(c *fiber.Ctx) error {
+	stripe := config.Get().Stripe
 	context := map[string]interface{}{
-		"planFreePID":       os.Getenv("STRIPE_FREE_PID"),
-		"planBusinessPID":   os.Getenv("STRIPE_BUSINESS_PID"),
-		"planEnterprisePID": os.Getenv("STRIPE_ENTERPRISE_PID"),
+		"planFreePID":       stripe.FreePID,
+		"planBusinessPID":   stripe.BusinessPID,
+		"planEnterprisePID": stripe.EnterprisePID,
 		"starterDomains":    2,
 		"businessDomains":   50,
 		"enterpriseDomains": 500,
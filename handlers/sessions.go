@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+)
+
+// HandleGetSessions lists the active sessions of the user.
+func HandleGetSessions(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	ss, err := repos.Sessions.List(c.UserContext(), user.ID)
+	if err != nil {
+		return err
+	}
+	current := ""
+	if sess := middleware.CurrentSession(c); sess != nil {
+		current = sess.ID
+	}
+	return Render(c, layouts.SessionsIndex(ss, current))
+}
+
+// HandlePostRevokeSession signs one of the sessions of the user out.
+func HandlePostRevokeSession(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	err := repos.Sessions.Revoke(c.UserContext(), user.ID, c.Params("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if sess := middleware.CurrentSession(c); sess != nil && sess.ID == c.Params("id") {
+		return signOut(c)
+	}
+	return HXRedirect(c, "/account/sessions")
+}
+
+// HandlePostRevokeAllSessions signs the user out everywhere, including the
+// refresh tokens Supabase issued outside of a session.
+func HandlePostRevokeAllSessions(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	if err := repos.Sessions.RevokeAll(c.UserContext(), user.ID, ""); err != nil {
+		return err
+	}
+	if err := sb.Client.Auth.SignOut(c.UserContext(), c.Cookies("access_Token")); err != nil {
+		logEvent.FromCtx(c).Warn("supabase sign out", "error", err)
+	}
+	return signOut(c)
+}
+
+// signOut clears the session cookies of the request and goes home.
+func signOut(c *fiber.Ctx) error {
+	if err := middleware.EndSession(c); err != nil {
+		return err
+	}
+	return HXRedirect(c, "/")
+}
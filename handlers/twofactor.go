@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/middleware"
+	v "github.com/NikoMalik/GoTrack/validate"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpPeriod is the lifetime of a TOTP code, the default of authenticator
+// apps.
+const totpPeriod = 30
+
+// challengeAttempts is how many wrong codes end a pending session, after
+// which the password has to be entered again.
+const challengeAttempts = 5
+
+// enrollTTL is how long the secret of an enrollment is shown again, so
+// reloading the page doesn't replace a secret that may already be scanned.
+const enrollTTL = time.Hour
+
+var codeSchema = v.Schema{"code": v.Rules(v.Required)}
+
+// twoFactorExempt are the pages members who still have to enable
+// two-factor authentication may use, besides signing in and out.
+var twoFactorExempt = map[string]bool{
+	"/account/2fa":        true,
+	"/account/2fa/enable": true,
+	"/account/switch":     true,
+}
+
+// checkTOTP returns the time step of code if it is a code of secret at
+// now, allowing a step of clock skew either way.
+func checkTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for _, skew := range []int64{0, -1, 1} {
+		step := now.Unix()/totpPeriod + skew
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// twoFactor returns the second factor of a user, which is nil if they
+// never enrolled.
+func twoFactor(ctx context.Context, userID string) (*data.TwoFactor, error) {
+	tf, err := repos.TwoFactor.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return tf, err
+}
+
+// verifySecondFactor checks a TOTP code of tf, or else one of the recovery
+// codes of its user. Every code is only accepted once.
+func verifySecondFactor(c *fiber.Ctx, tf *data.TwoFactor, code string) (bool, error) {
+	ctx := c.UserContext()
+	if step, ok := checkTOTP(tf.Secret, code, time.Now()); ok {
+		return repos.TwoFactor.UseStep(ctx, tf.UserID, step)
+	}
+	err := repos.TwoFactor.UseRecoveryCode(ctx, tf.UserID, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	audit(c, tf.UserID, "", data.TwoFactorAuditRecord(data.AuditRecoveryCodeUse, tf.UserID))
+	return true, nil
+}
+
+// requireTwoFactor sends members of an account that requires two-factor
+// authentication to the enrollment page until they enabled it. It reports
+// whether the request may go on.
+func requireTwoFactor(c *fiber.Ctx, user *data.AuthenticatedUser, m *data.Membership) (bool, error) {
+	if m.Account == nil || !m.Account.Require2FA {
+		return true, nil
+	}
+	if path := c.Path(); twoFactorExempt[path] || strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/static") {
+		return true, nil
+	}
+	tf, err := twoFactor(c.UserContext(), user.ID)
+	if err != nil {
+		return false, err
+	}
+	if tf.Enabled() {
+		return true, nil
+	}
+	if strings.HasPrefix(c.Path(), "/api/") {
+		return false, fiber.NewError(fiber.StatusForbidden, "two-factor authentication is required")
+	}
+	return false, HXRedirect(c, "/account/2fa")
+}
+
+// HandleGetTwoFactor shows the second factor of the user, or the secret to
+// enroll with. A pending secret is reused until enrollTTL passed.
+func HandleGetTwoFactor(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	ctx := c.UserContext()
+	tf, err := twoFactor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	page := layouts.TwoFactorPage{}
+	if m := currentMembership(c); m != nil && m.Account != nil {
+		page.Required = m.Account.Require2FA
+	}
+	if tf.Enabled() {
+		page.Enabled = true
+		if page.CodesLeft, err = repos.TwoFactor.RecoveryCodesLeft(ctx, user.ID); err != nil {
+			return err
+		}
+		return Render(c, layouts.TwoFactorIndex(page))
+	}
+
+	opts := totp.GenerateOpts{
+		Issuer:      "GoTrack",
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	}
+	pending := tf != nil && time.Since(tf.CreatedAt) < enrollTTL
+	if pending {
+		if opts.Secret, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(tf.Secret); err != nil {
+			return err
+		}
+	}
+	key, err := totp.Generate(opts)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		if err := repos.TwoFactor.Begin(ctx, &data.TwoFactor{UserID: user.ID, Secret: key.Secret(), CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	page.Secret = key.Secret()
+	page.QR = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	return Render(c, layouts.TwoFactorIndex(page))
+}
+
+// HandlePostEnableTwoFactor enables the pending second factor with its
+// first code and shows the recovery codes, once. The other sessions of the
+// user, signed in with the password only, are signed out.
+func HandlePostEnableTwoFactor(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	var params layouts.TwoFactorParams
+	errs, ok := v.Request(c.Context(), &params, codeSchema)
+	if !ok {
+		return Render(c, layouts.TwoFactorEnableForm(errs))
+	}
+	ctx := c.UserContext()
+	tf, err := twoFactor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if tf == nil || tf.Enabled() {
+		return HXRedirect(c, "/account/2fa")
+	}
+	step, ok := checkTOTP(tf.Secret, params.Code, time.Now())
+	if !ok {
+		errs.Add("code", "is not correct")
+		return Render(c, layouts.TwoFactorEnableForm(errs))
+	}
+
+	codes := data.NewRecoveryCodes()
+	if err := repos.TwoFactor.Enable(ctx, user.ID, step, codes); err != nil {
+		return err
+	}
+	current := ""
+	if sess := middleware.CurrentSession(c); sess != nil {
+		current = sess.ID
+	}
+	if err := repos.Sessions.RevokeAll(ctx, user.ID, current); err != nil {
+		return err
+	}
+	c.Set("HX-Retarget", "#two-factor")
+	return Render(c, layouts.RecoveryCodes(codes))
+}
+
+// HandlePostDisableTwoFactor disables the second factor of the user, who
+// confirms with a code.
+func HandlePostDisableTwoFactor(c *fiber.Ctx) error {
+	user := getAuthenticatedUser(c)
+	var params layouts.TwoFactorParams
+	errs, ok := v.Request(c.Context(), &params, codeSchema)
+	if !ok {
+		return Render(c, layouts.TwoFactorDisableForm(errs))
+	}
+	ctx := c.UserContext()
+	tf, err := twoFactor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !tf.Enabled() {
+		return HXRedirect(c, "/account/2fa")
+	}
+	if m := currentMembership(c); m != nil && m.Account != nil && m.Account.Require2FA {
+		return fiber.ErrForbidden
+	}
+	ok, err = verifySecondFactor(c, tf, params.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		errs.Add("code", "is not correct")
+		return Render(c, layouts.TwoFactorDisableForm(errs))
+	}
+	if err := repos.TwoFactor.Disable(ctx, user.ID); err != nil {
+		return err
+	}
+	return HXRedirect(c, "/account/2fa")
+}
+
+// HandlePostRequireTwoFactor turns the two-factor requirement of the
+// account on or off. Whoever turns it on needs a second factor first.
+func HandlePostRequireTwoFactor(c *fiber.Ctx) error {
+	user, m := getAuthenticatedUser(c), currentMembership(c)
+	ctx := c.UserContext()
+	require := c.FormValue("require") == "true"
+	if require {
+		tf, err := twoFactor(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !tf.Enabled() {
+			return HXRedirect(c, "/account/2fa")
+		}
+	}
+	acc, err := repos.Accounts.Get(ctx, m.AccountID)
+	if err != nil {
+		return err
+	}
+	acc.Require2FA = require
+	if err := repos.Accounts.Update(ctx, acc); err != nil {
+		return err
+	}
+	return HXRedirect(c, "/account/members")
+}
+
+// HandleGetTwoFactorChallenge asks for the second factor after the
+// password was accepted.
+func HandleGetTwoFactorChallenge(c *fiber.Ctx) error {
+	if middleware.PendingSession(c) == nil {
+		return c.Redirect("/auth/login")
+	}
+	return Render(c, layouts.TwoFactorChallenge())
+}
+
+// HandlePostTwoFactorChallenge signs the user of the pending session in
+// with a TOTP or recovery code. Too many wrong codes end the session.
+func HandlePostTwoFactorChallenge(c *fiber.Ctx) error {
+	sess := middleware.PendingSession(c)
+	if sess == nil {
+		return HXRedirect(c, "/auth/login")
+	}
+	var params layouts.TwoFactorParams
+	errs, ok := v.Request(c.Context(), &params, codeSchema)
+	if !ok {
+		return Render(c, layouts.TwoFactorChallengeForm(errs))
+	}
+	tf, err := twoFactor(c.UserContext(), sess.UserID)
+	if err != nil {
+		return err
+	}
+	// The second factor may have been disabled since the password was
+	// accepted.
+	if tf.Enabled() {
+		ok, err := verifySecondFactor(c, tf, params.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			audit(c, sess.UserID, "", data.AuditRecord{
+				Action:     data.AuditTwoFactorFailed,
+				TargetType: "user",
+				TargetID:   sess.UserID,
+			})
+			failed, err := repos.Sessions.Fail(c.UserContext(), sess.ID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if err != nil || failed >= challengeAttempts {
+				logEvent.FromCtx(c).Warn("two-factor challenge: too many wrong codes", "id", sess.UserID)
+				if err := middleware.EndSession(c); err != nil {
+					return err
+				}
+				return HXRedirect(c, "/auth/login")
+			}
+			errs.Add("code", "is not correct")
+			return Render(c, layouts.TwoFactorChallengeForm(errs))
+		}
+	}
+
+	if err := middleware.CompleteSession(c); err != nil {
+		return err
+	}
+	audit(c, sess.UserID, "", data.AuditRecord{
+		Action:     data.AuditLogin,
+		TargetType: "user",
+		TargetID:   sess.UserID,
+	})
+	return HXRedirect(c, "/")
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	Init(memory.NewRepos(memory.NewStore()))
+	ctx := context.Background()
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, &data.AuthenticatedUser{ID: "u1", Email: "a@example.com", LoggedIn: true})
+		return c.Next()
+	}, WithAccount)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/hosts", ok)
+	app.Get("/account/2fa", ok)
+	status := func(target string) (int, string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderLocation)
+	}
+
+	// The first request creates the account, which then requires 2FA.
+	status("/hosts")
+	acc, err := repos.Accounts.GetByUserID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.Require2FA = true
+	if err := repos.Accounts.Update(ctx, acc); err != nil {
+		t.Fatal(err)
+	}
+	if code, loc := status("/hosts"); code != fiber.StatusFound || loc != "/account/2fa" {
+		t.Errorf("without 2FA: status %d, location %q", code, loc)
+	}
+	if code, _ := status("/account/2fa"); code != fiber.StatusOK {
+		t.Errorf("enrollment page: status %d", code)
+	}
+
+	key, _ := totp.Generate(totp.GenerateOpts{Issuer: "GoTrack", AccountName: "a@example.com"})
+	if err := repos.TwoFactor.Begin(ctx, &data.TwoFactor{UserID: "u1", Secret: key.Secret()}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, _ := totp.GenerateCode(key.Secret(), now)
+	step, valid := checkTOTP(key.Secret(), code, now)
+	if !valid {
+		t.Fatal("current code rejected")
+	}
+	if _, valid := checkTOTP(key.Secret(), code, now.Add(5*time.Minute)); valid {
+		t.Error("old code accepted")
+	}
+	codes := data.NewRecoveryCodes()
+	if err := repos.TwoFactor.Enable(ctx, "u1", step, codes); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := status("/hosts"); code != fiber.StatusOK {
+		t.Errorf("with 2FA: status %d", code)
+	}
+
+	// Neither the enrollment code nor a recovery code work twice.
+	if ok, _ := repos.TwoFactor.UseStep(ctx, "u1", step); ok {
+		t.Error("code replayed")
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(ctx, "u1", codes[0]); err != nil {
+		t.Errorf("recovery code: %v", err)
+	}
+	if err := repos.TwoFactor.UseRecoveryCode(ctx, "u1", codes[0]); err == nil {
+		t.Error("recovery code used twice")
+	}
+	if n, _ := repos.TwoFactor.RecoveryCodesLeft(ctx, "u1"); n != data.RecoveryCodeCount-1 {
+		t.Errorf("recovery codes left = %d", n)
+	}
+}
+
+func TestTwoFactorChallengeLockout(t *testing.T) {
+	Init(memory.NewRepos(memory.NewStore()))
+	middleware.Init(repos.Sessions, repos.APIKeys)
+	ctx := context.Background()
+	key, _ := totp.Generate(totp.GenerateOpts{Issuer: "GoTrack", AccountName: "a@example.com"})
+	if err := repos.TwoFactor.Begin(ctx, &data.TwoFactor{UserID: "u1", Secret: key.Secret()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(ctx, "u1", 0, data.NewRecoveryCodes()); err != nil {
+		t.Fatal(err)
+	}
+	sess, secret := data.NewSession("u1", "refresh", "0.0.0.0", "test")
+	sess.Pending = true
+	if err := repos.Sessions.Create(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(middleware.OptionalAuth)
+	app.Post("/auth/2fa", HandlePostTwoFactorChallenge)
+	post := func() int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/auth/2fa", strings.NewReader("code=000000"))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "session="+secret)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for i := 1; i < challengeAttempts; i++ {
+		if status := post(); status != fiber.StatusOK {
+			t.Fatalf("wrong code %d: status %d", i, status)
+		}
+	}
+	if status := post(); status != fiber.StatusFound {
+		t.Errorf("last wrong code: status %d, want a redirect to the login", status)
+	}
+	if _, err := repos.Sessions.Get(ctx, sess.ID); err == nil {
+		t.Error("pending session kept after too many wrong codes")
+	}
+}
+
+func TestTwoFactorEnrollmentKeepsSecret(t *testing.T) {
+	Init(memory.NewRepos(memory.NewStore()))
+	ctx := context.Background()
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		middleware.SetUser(c, &data.AuthenticatedUser{ID: "u1", Email: "a@example.com", LoggedIn: true})
+		return c.Next()
+	})
+	app.Get("/account/2fa", HandleGetTwoFactor)
+	secret := func() string {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/account/2fa", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		tf, err := repos.TwoFactor.Get(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tf.Secret
+	}
+
+	first := secret()
+	if again := secret(); again != first {
+		t.Errorf("reloading the page replaced the secret %q with %q", first, again)
+	}
+}
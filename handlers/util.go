@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -19,10 +23,20 @@ func HXRedirect(c *fiber.Ctx, to string) error {
 	return c.Redirect(to, fiber.StatusFound)
 }
 
-func getAuthenticatedUser(c *fiber.Ctx) *data.AuthenticatedUser {
-	value := c.Locals("user")
-	if user, ok := value.(*data.AuthenticatedUser); ok {
-		return user
+// localPath returns the path and query of ref if it points at this site,
+// and "/" otherwise, so it is safe to redirect to.
+func localPath(c *fiber.Ctx, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || (u.Host != "" && u.Host != c.Hostname()) {
+		return "/"
+	}
+	if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") || strings.ContainsRune(u.Path, '\\') {
+		return "/"
 	}
-	return nil
+	u = &url.URL{Path: u.Path, RawQuery: u.RawQuery}
+	return u.String()
+}
+
+func getAuthenticatedUser(c *fiber.Ctx) *data.AuthenticatedUser {
+	return middleware.User(c)
 }
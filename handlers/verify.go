@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/views/layouts"
+	"github.com/a-h/templ"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verificationAudience marks email verification tokens, so no other token
+// signed with the same secret passes for one.
+const verificationAudience = "email-verification"
+
+type verificationClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// newVerificationToken returns a token verifying the current email address
+// of user that expires after ttl.
+func newVerificationToken(secret []byte, user *data.User, ttl time.Duration) (string, time.Time, error) {
+	exp := time.Now().Add(ttl)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, verificationClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		Email: user.Email,
+	}).SignedString(secret)
+	return token, exp, err
+}
+
+// parseVerificationToken returns the claims of a valid verification token.
+// The claims of an expired token are returned with jwt.ErrTokenExpired.
+func parseVerificationToken(secret []byte, token string) (*verificationClaims, error) {
+	claims := &verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithAudience(verificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	return claims, err
+}
+
+// HandleResendVerificationCode mails a new verification link to the
+// address in the form, or to the signed in user. The response is the same
+// whether or not a mail is sent, so it can't be used to find accounts.
+func HandleResendVerificationCode(c *fiber.Ctx) error {
+	email := c.FormValue("email")
+	if user := getAuthenticatedUser(c); email == "" && user != nil {
+		email = user.Email
+	}
+	done := layouts.Toast("Verification", "If the address belongs to an unverified account, a new link is on its way.")
+
+	l := logEvent.FromCtx(c)
+	ctx := c.UserContext()
+	user, err := repos.Users.GetByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Render(c, done)
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt.Valid {
+		l.Info("user already verified", "id", user.ID)
+		return Render(c, done)
+	}
+
+	auth := config.Get().Auth
+	token, exp, err := newVerificationToken([]byte(auth.JWTSecret), user, auth.EmailVerificationExpiry())
+	if err != nil {
+		return err
+	}
+	var sent bool
+	err = repos.Tx.InTx(ctx, func(ctx context.Context, r *data.Repos) error {
+		ok, err := r.Users.MarkVerificationSent(ctx, user.ID, auth.VerificationResendInterval)
+		if err != nil || !ok {
+			return err
+		}
+		sent = true
+		return r.Publisher.Publish(ctx, data.ResendVerificationEvent, data.VerificationRequested{
+			Email:     user.Email,
+			Name:      user.Name,
+			URL:       config.Get().HTTP.BaseURL + "/auth/verify?token=" + url.QueryEscape(token),
+			ExpiresAt: exp,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if !sent {
+		l.Info("verification mail rate limited", "id", user.ID)
+		return Render(c, done)
+	}
+	l.Info("user verification email sent", "id", user.ID)
+	return Render(c, done)
+}
+
+// HandleVerifyEmail marks the address of a verification link as verified.
+func HandleVerifyEmail(c *fiber.Ctx) error {
+	secret := []byte(config.Get().Auth.JWTSecret)
+	claims, err := parseVerificationToken(secret, c.Query("token"))
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return Render(c, layouts.VerifyEmail(layouts.VerifyExpired, claims.Email), templ.WithStatus(fiber.StatusBadRequest))
+	case err != nil:
+		return Render(c, layouts.VerifyEmail(layouts.VerifyInvalid, ""), templ.WithStatus(fiber.StatusBadRequest))
+	}
+	err = repos.Users.VerifyEmail(c.UserContext(), claims.Subject, claims.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The user is gone or changed their address since.
+		return Render(c, layouts.VerifyEmail(layouts.VerifyInvalid, ""), templ.WithStatus(fiber.StatusBadRequest))
+	}
+	if err != nil {
+		return err
+	}
+	return Render(c, layouts.VerifyEmail(layouts.VerifyDone, claims.Email))
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerificationToken(t *testing.T) {
+	secret := []byte("secret")
+	user := &data.User{ID: "u1", Email: "a@example.com"}
+
+	token, _, err := newVerificationToken(secret, user, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseVerificationToken(secret, token)
+	if err != nil || claims.Subject != "u1" || claims.Email != "a@example.com" {
+		t.Fatalf("claims = %+v, err = %v", claims, err)
+	}
+
+	// The expired page offers to resend to the address of the token.
+	expired, _, _ := newVerificationToken(secret, user, -time.Hour)
+	claims, err = parseVerificationToken(secret, expired)
+	if !errors.Is(err, jwt.ErrTokenExpired) || claims.Email != "a@example.com" {
+		t.Errorf("expired token: claims = %+v, err = %v", claims, err)
+	}
+
+	// Other tokens signed with the same secret don't verify addresses.
+	other, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "u1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString(secret)
+	if _, err := parseVerificationToken(secret, other); err == nil {
+		t.Error("token without the verification audience accepted")
+	}
+	if _, err := parseVerificationToken([]byte("guess"), token); err == nil {
+		t.Error("token with a wrong signature accepted")
+	}
+}
@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DrainFunc stops the intake of a component and waits for its in-flight work
+// until ctx is done. It returns the number of items that were dropped.
+type DrainFunc func(ctx context.Context) (dropped int, err error)
+
+// Result is the outcome of draining a single component.
+type Result struct {
+	Name     string
+	Dropped  int
+	Err      error
+	Duration time.Duration
+}
+
+// Report is the outcome of a shutdown.
+type Report []Result
+
+// Dropped returns the total amount of dropped items.
+func (r Report) Dropped() int {
+	n := 0
+	for _, res := range r {
+		n += res.Dropped
+	}
+	return n
+}
+
+// String returns a one line summary per component.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, res := range r {
+		fmt.Fprintf(&b, "%s: dropped=%d took=%s", res.Name, res.Dropped, res.Duration.Round(time.Millisecond))
+		if res.Err != nil {
+			fmt.Fprintf(&b, " err=%v", res.Err)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type component struct {
+	name  string
+	drain DrainFunc
+}
+
+var (
+	mu         sync.Mutex
+	components []component
+)
+
+// Register registers a component to be drained on shutdown.
+// Components are drained in the order they were registered, so register the
+// ones that produce work (HTTP server, scheduler) before the ones that
+// consume it (event bus, mail queue).
+func Register(name string, fn DrainFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	components = append(components, component{name: name, drain: fn})
+}
+
+// Shutdown drains every registered component within the given deadline and
+// logs anything that was dropped. Each component gets an equal share of the
+// time that is left when its turn comes, so a slow component can't use up
+// the budget of the ones after it, while time a fast one didn't need goes
+// to the rest.
+func Shutdown(deadline time.Duration) Report {
+	end := time.Now().Add(deadline)
+
+	mu.Lock()
+	comps := components
+	components = nil
+	mu.Unlock()
+
+	report := make(Report, 0, len(comps))
+	for i, c := range comps {
+		start := time.Now()
+		share := end.Sub(start) / time.Duration(len(comps)-i)
+		ctx, cancel := context.WithTimeout(context.Background(), share)
+		dropped, err := c.drain(ctx)
+		cancel()
+		res := Result{
+			Name:     c.name,
+			Dropped:  dropped,
+			Err:      err,
+			Duration: time.Since(start),
+		}
+		if dropped > 0 || err != nil {
+			log.Printf("shutdown: %s dropped %d item(s): %v", c.name, dropped, err)
+		}
+		report = append(report, res)
+	}
+	return report
+}
@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownSharesTheDeadline(t *testing.T) {
+	// The first component hangs until its context is done.
+	Register("http", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 2, ctx.Err()
+	})
+	var left []time.Duration
+	for _, name := range []string{"mail", "db"} {
+		Register(name, func(ctx context.Context) (int, error) {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			deadline, _ := ctx.Deadline()
+			left = append(left, time.Until(deadline))
+			return 0, nil
+		})
+	}
+
+	report := Shutdown(300 * time.Millisecond)
+
+	if len(report) != 3 || report[0].Name != "http" || report[2].Name != "db" {
+		t.Fatalf("report = %v", report)
+	}
+	if !errors.Is(report[0].Err, context.DeadlineExceeded) || report[0].Duration > 200*time.Millisecond {
+		t.Errorf("http took %s: %v, want its share of the deadline", report[0].Duration, report[0].Err)
+	}
+	for i, res := range report[1:] {
+		if res.Err != nil {
+			t.Errorf("%s: %v, want time left after http", res.Name, res.Err)
+		}
+		if i < len(left) && left[i] < 50*time.Millisecond {
+			t.Errorf("%s got %s", res.Name, left[i])
+		}
+	}
+	if report.Dropped() != 2 {
+		t.Errorf("dropped %d, want 2", report.Dropped())
+	}
+	if len(components) != 0 {
+		t.Error("components kept after shutdown")
+	}
+}
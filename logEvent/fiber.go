@@ -0,0 +1,84 @@
+package logEvent
+
+import (
+	"sync/atomic"
+	"time"
+
+	kitlog "github.com/go-kit/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	localsKey       = "logger"
+	requestIDHeader = "X-Request-ID"
+)
+
+// Middleware attaches a child logger carrying the request id, method,
+// route and trace ids to every request and writes one access line once the
+// request is handled. The request id is taken from the X-Request-ID header
+// or generated.
+func Middleware(c *fiber.Ctx) error {
+	id := c.Get(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDHeader, id)
+
+	// The route is only known once the request is routed, so it is read
+	// when a line is logged. Lines logged after the request keep the
+	// route it was served by, as the context is reused.
+	var served atomic.Pointer[string]
+	route := kitlog.Valuer(func() any {
+		if r := served.Load(); r != nil {
+			return *r
+		}
+		return c.Route().Path
+	})
+	l := FromContext(c.UserContext()).With("request_id", id, "method", c.Method(), "route", route)
+	SetCtx(c, l)
+
+	start := time.Now()
+	err := c.Next()
+	path := c.Route().Path
+	served.Store(&path)
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		if fe, ok := err.(*fiber.Error); ok {
+			status = fe.Code
+		} else {
+			status = fiber.StatusInternalServerError
+		}
+	}
+
+	l = FromCtx(c)
+	keyvals := []any{"path", c.Path(), "status", status, "duration", time.Since(start)}
+	if err != nil {
+		keyvals = append(keyvals, "error", err)
+	}
+	switch {
+	case status >= 500:
+		l.Error("request", keyvals...)
+	case status >= 400:
+		l.Warn("request", keyvals...)
+	default:
+		l.Info("request", keyvals...)
+	}
+	return err
+}
+
+// SetCtx makes l the request scoped logger of c.
+func SetCtx(c *fiber.Ctx, l *Logger) {
+	c.Locals(localsKey, l)
+	c.SetUserContext(WithContext(c.UserContext(), l))
+}
+
+// FromCtx returns the request scoped logger of c, or the root logger if
+// Middleware didn't run.
+func FromCtx(c *fiber.Ctx) *Logger {
+	if l, ok := c.Locals(localsKey).(*Logger); ok {
+		return l
+	}
+	return FromContext(c.UserContext())
+}
@@ -1,47 +1,217 @@
 package logEvent
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"syscall"
 
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/tracing"
 	kitlog "github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 )
 
-var logger kitlog.Logger
+// Logger is a leveled logger. Every key/value pair passes through the
+// redaction list before it is written.
+type Logger struct {
+	kl kitlog.Logger
+}
 
-// Init initializes the logger with the provided environment variable name
-func Init(envVar string) {
-	var (
-		logout io.Writer
-		err    error
-	)
+var root atomic.Pointer[Logger]
 
-	// Check if the environment variable is set
-	logpath := os.Getenv(envVar)
-	if logpath == "" {
-		// If not set, default to standard error
-		logout = os.Stderr
-	} else {
-		// If set, ensure the log file exists and open it
-		if _, err := os.Stat(logpath); os.IsNotExist(err) {
-			_, err := os.Create(logpath)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-		logout, err = os.OpenFile(logpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+func init() {
+	root.Store(newLogger(os.Stderr, "logfmt", level.AllowInfo()))
+}
+
+var (
+	current config.Log
+	file    *RotatingFile
+	hup     chan os.Signal
+)
+
+// Init initializes the root logger from the config. Logs are written to
+// cfg.File, or to standard error if it is empty. The file is rotated
+// according to cfg and reopened on SIGHUP.
+func Init(cfg config.Log) {
+	var logout io.Writer = os.Stderr
+
+	if cfg.File != "" {
+		f, err := OpenRotatingFile(cfg.File, RotateConfig{
+			MaxSize:  int64(cfg.MaxSizeMB) << 20,
+			MaxAge:   cfg.MaxAge,
+			MaxFiles: cfg.MaxFiles,
+			Compress: cfg.Compress,
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
+		file = f
+		logout = f
+
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func(ch chan os.Signal) {
+			for range ch {
+				if err := f.Reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "logEvent: reopen %s: %v\n", cfg.File, err)
+				}
+			}
+		}(hup)
+	}
+
+	current = cfg
+	SetRedactKeys(cfg.RedactKeys())
+	root.Store(newLogger(logout, cfg.Format, levelOption(cfg.Level)))
+}
+
+// Close stops the SIGHUP handler and closes the log file. Later log lines
+// go to standard error.
+func Close() error {
+	if file == nil {
+		return nil
+	}
+	signal.Stop(hup)
+	close(hup)
+	root.Store(newLogger(os.Stderr, current.Format, levelOption(current.Level)))
+	err := file.Close()
+	file = nil
+	return err
+}
+
+func newLogger(w io.Writer, format string, allow level.Option) *Logger {
+	var kl kitlog.Logger
+	if format == "json" {
+		kl = kitlog.NewJSONLogger(kitlog.NewSyncWriter(w))
+	} else {
+		kl = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(w))
+	}
+	kl = kitlog.With(kl, "ts", kitlog.DefaultTimestampUTC)
+	return &Logger{kl: level.NewFilter(kl, allow)}
+}
+
+func levelOption(lvl string) level.Option {
+	switch lvl {
+	case "debug":
+		return level.AllowDebug()
+	case "warn":
+		return level.AllowWarn()
+	case "error":
+		return level.AllowError()
+	default:
+		return level.AllowInfo()
+	}
+}
+
+// With returns a child logger that adds keyvals to every line.
+func (l *Logger) With(keyvals ...any) *Logger {
+	return &Logger{kl: kitlog.With(l.kl, redact(keyvals)...)}
+}
+
+// Debug logs msg at debug level.
+func (l *Logger) Debug(msg string, keyvals ...any) {
+	l.log(level.DebugValue(), msg, keyvals)
+}
+
+// Info logs msg at info level.
+func (l *Logger) Info(msg string, keyvals ...any) {
+	l.log(level.InfoValue(), msg, keyvals)
+}
+
+// Warn logs msg at warn level.
+func (l *Logger) Warn(msg string, keyvals ...any) {
+	l.log(level.WarnValue(), msg, keyvals)
+}
+
+// Error logs msg at error level.
+func (l *Logger) Error(msg string, keyvals ...any) {
+	l.log(level.ErrorValue(), msg, keyvals)
+}
+
+func (l *Logger) log(lvl level.Value, msg string, keyvals []any) {
+	kv := make([]any, 0, len(keyvals)+6)
+	kv = append(kv, level.Key(), lvl, "caller", caller(3), "msg", msg)
+	kv = append(kv, redact(keyvals)...)
+	_ = l.kl.Log(kv...)
+}
+
+// caller returns file:line of the function depth frames up the stack.
+func caller(depth int) string {
+	_, file, line, ok := runtime.Caller(depth)
+	if !ok {
+		return "???"
 	}
+	return filepath.Base(file) + ":" + strconv.Itoa(line)
+}
+
+// Root returns the application wide logger.
+func Root() *Logger {
+	return root.Load()
+}
+
+// Debug logs msg at debug level on the root logger.
+func Debug(msg string, keyvals ...any) {
+	root.Load().log(level.DebugValue(), msg, keyvals)
+}
 
-	// Initialize the kitlog logger
-	logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(logout))
-	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestampUTC, "caller", kitlog.Caller(4))
+// Info logs msg at info level on the root logger.
+func Info(msg string, keyvals ...any) {
+	root.Load().log(level.InfoValue(), msg, keyvals)
 }
 
-// Log logs a message with the initialized logger
+// Warn logs msg at warn level on the root logger.
+func Warn(msg string, keyvals ...any) {
+	root.Load().log(level.WarnValue(), msg, keyvals)
+}
+
+// Error logs msg at error level on the root logger.
+func Error(msg string, keyvals ...any) {
+	root.Load().log(level.ErrorValue(), msg, keyvals)
+}
+
+// Log logs the key/value pairs at info level with the root logger
 func Log(args ...any) error {
-	return logger.Log(args...)
+	kv := make([]any, 0, len(args)+4)
+	kv = append(kv, level.Key(), level.InfoValue(), "caller", caller(2))
+	kv = append(kv, redact(args)...)
+	return root.Load().kl.Log(kv...)
+}
+
+// LogContext logs like Log and adds the trace and span id of ctx, so log
+// lines can be correlated with traces.
+func LogContext(ctx context.Context, args ...any) error {
+	if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+		args = append(args, "trace_id", traceID, "span_id", spanID)
+	}
+	kv := make([]any, 0, len(args)+4)
+	kv = append(kv, level.Key(), level.InfoValue(), "caller", caller(2))
+	kv = append(kv, redact(args)...)
+	return root.Load().kl.Log(kv...)
+}
+
+type ctxKey struct{}
+
+// WithContext returns a copy of ctx carrying l.
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, which carries the trace
+// and span id already, or else the root logger with those of ctx attached.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l
+	}
+	l := root.Load()
+	if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+		l = l.With("trace_id", traceID, "span_id", spanID)
+	}
+	return l
 }
@@ -0,0 +1,85 @@
+package logEvent
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log/level"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, "json", level.AllowDebug())
+
+	params := struct {
+		Email    string
+		Password string
+	}{"a@b.c", "hunter2"}
+	l.Info("signup", "params", &params, "access_token", "abc", "data", map[string]string{"Secret": "s3"})
+	l.Info("nested",
+		"meta", map[string]any{"user": map[string]any{"Token": "t0k"}, "list": []any{params}},
+		"wrapped", struct{ Data any }{map[string]string{"refresh_token": "r3f"}},
+	)
+
+	out := buf.String()
+	for _, leak := range []string{"hunter2", "abc", "s3", "t0k", "r3f"} {
+		if strings.Contains(out, leak) {
+			t.Fatalf("%q leaked into %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, "a@b.c") || !strings.Contains(out, `"level":"info"`) {
+		t.Fatalf("unexpected output %s", out)
+	}
+}
+
+func TestLevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, "logfmt", levelOption("warn"))
+
+	l.Info("dropped")
+	l.Warn("kept")
+
+	if out := buf.String(); strings.Contains(out, "dropped") || !strings.Contains(out, "msg=kept") {
+		t.Fatalf("unexpected output %s", out)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	prev := root.Load()
+	root.Store(newLogger(&buf, "logfmt", level.AllowDebug()))
+	defer root.Store(prev)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(trace.ContextWithSpanContext(c.UserContext(), sc))
+		return c.Next()
+	}, Middleware)
+	app.Get("/hosts/:id", func(c *fiber.Ctx) error {
+		// Like the auth middleware, which adds the user.
+		SetCtx(c, FromCtx(c).With("user_id", "u1"))
+		FromContext(c.UserContext()).Info("handled")
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest("GET", "/hosts/1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if n := strings.Count(line, "trace_id="); n != 1 {
+			t.Errorf("trace_id %d times in %s", n, line)
+		}
+		if !strings.Contains(line, "route=/hosts/:id") || !strings.Contains(line, "user_id=u1") {
+			t.Errorf("route or user missing in %s", line)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package logEvent
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	redactMu sync.RWMutex
+	// redactKeys holds lower case key fragments whose values are never logged.
+	redactKeys = []string{"password", "token", "secret", "authorization", "cookie", "apikey", "api_key"}
+)
+
+// SetRedactKeys adds keys to the redaction list. A key or struct field is
+// redacted when its lower cased name contains one of the entries.
+func SetRedactKeys(keys []string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	for _, k := range keys {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			redactKeys = append(redactKeys, k)
+		}
+	}
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+	for _, k := range redactKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns a copy of keyvals with sensitive values masked. Structs,
+// maps and slices, also behind interfaces, are copied with their sensitive
+// fields masked.
+func redact(keyvals []any) []any {
+	out := make([]any, len(keyvals))
+	for i := 0; i < len(keyvals); i++ {
+		if i%2 == 1 {
+			if k, ok := keyvals[i-1].(string); ok && sensitive(k) {
+				out[i] = redacted
+				continue
+			}
+		}
+		out[i] = redactValue(reflect.ValueOf(keyvals[i]), 0)
+	}
+	return out
+}
+
+func redactValue(v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(error); ok {
+		return v.Interface()
+	}
+	// Structs that format themselves, like time.Time, are logged as is.
+	if _, ok := v.Interface().(fmt.Stringer); ok && v.Kind() == reflect.Struct {
+		return v.Interface()
+	}
+	if depth > 4 {
+		// Too deep to look into, and so too deep to know it's safe.
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+			return redacted
+		}
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), depth)
+	case reflect.Struct:
+		t := v.Type()
+		m := make(map[string]any, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			if sensitive(sf.Name) {
+				m[sf.Name] = redacted
+				continue
+			}
+			m[sf.Name] = redactValue(v.Field(i), depth+1)
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			if sensitive(k) {
+				m[k] = redacted
+				continue
+			}
+			m[k] = redactValue(iter.Value(), depth+1)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), depth+1)
+		}
+		return out
+	}
+	return v.Interface()
+}
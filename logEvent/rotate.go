@@ -0,0 +1,313 @@
+package logEvent
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileMode     = 0o640
+	dirMode      = 0o750
+	backupFormat = "20060102T150405.000"
+)
+
+// RotateConfig configures a RotatingFile. Zero values disable the
+// corresponding limit.
+type RotateConfig struct {
+	// MaxSize is the size in bytes after which the file is rotated.
+	MaxSize int64
+	// MaxAge is the age after which the file is rotated.
+	MaxAge time.Duration
+	// MaxFiles is the number of rotated files that are kept.
+	MaxFiles int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// RotatingFile is an io.Writer that rotates the underlying file once it
+// grows too big or too old. It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+	cfg  RotateConfig
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// since is when the first line of the file was written, as far as
+	// known, and MaxAge is counted from it.
+	since time.Time
+
+	// cleanup serializes compressing and pruning of rotated files.
+	cleanup chan struct{}
+	wg      sync.WaitGroup
+}
+
+// OpenRotatingFile opens or creates the file at path for appending.
+func OpenRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:    path,
+		cfg:     cfg,
+		cleanup: make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.cleaner()
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// Files created by older versions were world writable.
+	if info.Mode().Perm() != fileMode {
+		_ = f.Chmod(fileMode)
+	}
+	r.f = f
+	r.size = info.Size()
+	// A file left over from before a restart is at least as old as its
+	// last write.
+	r.since = info.ModTime()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size == 0 {
+		r.since = time.Now()
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.cfg.MaxSize > 0 && r.size+n > r.cfg.MaxSize {
+		return true
+	}
+	return r.cfg.MaxAge > 0 && time.Since(r.since) > r.cfg.MaxAge
+}
+
+// rotate renames the current file and opens a new one. r.mu must be held.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	backup := backupName(r.path, time.Now())
+	if err := os.Rename(r.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	select {
+	case r.cleanup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupName returns an unused name for a file rotated at t.
+func backupName(path string, t time.Time) string {
+	name := path + "." + t.Format(backupFormat)
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%s-%d", path, t.Format(backupFormat), i)
+	}
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// Rotate rotates the file right away.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+// Reopen closes and reopens the file at the same path. It is used after an
+// external tool like logrotate moved the file away.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close closes the file and waits for pending compression to finish.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.f == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	close(r.cleanup)
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *RotatingFile) cleaner() {
+	defer r.wg.Done()
+	for range r.cleanup {
+		if err := r.compressAndPrune(); err != nil {
+			fmt.Fprintf(os.Stderr, "logEvent: rotate %s: %v\n", r.path, err)
+		}
+	}
+}
+
+// parseBackup returns the rotation time and sequence number encoded in the
+// name of a file rotated from path, and false if name is no such file.
+func parseBackup(path, name string) (time.Time, int, bool) {
+	suffix, ok := strings.CutPrefix(name, path+".")
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	stamp, seq, hasSeq := strings.Cut(suffix, "-")
+	t, err := time.Parse(backupFormat, stamp)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	n := 0
+	if hasSeq {
+		if n, err = strconv.Atoi(seq); err != nil || n < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return t, n, true
+}
+
+// backups returns the rotated files, oldest first. Other files next to the
+// log file are left out.
+func (r *RotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		name string
+		at   time.Time
+		seq  int
+	}
+	var files []backup
+	for _, name := range matches {
+		if at, seq, ok := parseBackup(r.path, name); ok {
+			files = append(files, backup{name, at, seq})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].at.Equal(files[j].at) {
+			return files[i].at.Before(files[j].at)
+		}
+		return files[i].seq < files[j].seq
+	})
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+func (r *RotatingFile) compressAndPrune() error {
+	files, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	if r.cfg.Compress {
+		for i, name := range files {
+			if strings.HasSuffix(name, ".gz") {
+				continue
+			}
+			if err := compress(name); err != nil {
+				return err
+			}
+			files[i] = name + ".gz"
+		}
+	}
+
+	if r.cfg.MaxFiles > 0 && len(files) > r.cfg.MaxFiles {
+		for _, name := range files[:len(files)-r.cfg.MaxFiles] {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
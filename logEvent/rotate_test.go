@@ -0,0 +1,116 @@
+package logEvent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotrack.log")
+	r, err := OpenRotatingFile(path, RotateConfig{MaxSize: 1024, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := r.Write(line); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1024 {
+		t.Errorf("current file has %d bytes, want at most 1024", info.Size())
+	}
+	if info.Mode().Perm() != fileMode {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(fileMode))
+	}
+
+	// Writes are never split across files.
+	if info.Size()%int64(len(line)) != 0 {
+		t.Errorf("current file holds a partial line")
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) == 0 || len(backups) > 2 {
+		t.Fatalf("got %d rotated files, want 1 or 2", len(backups))
+	}
+	for _, name := range backups {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("%s is not compressed", name)
+		}
+	}
+}
+
+func TestBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gotrack.log")
+	at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC).Format(backupFormat)
+	want := []string{
+		path + "." + at + ".gz",
+		path + "." + at + "-2",
+		path + "." + at + "-10.gz",
+		path + "." + time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC).Format(backupFormat),
+	}
+	for _, name := range append(want, path+".bak", path+".lock", path+"."+at+"-x") {
+		if err := os.WriteFile(name, nil, fileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := (&RotatingFile{path: path}).backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("backups = %q, want %q", got, want)
+	}
+}
+
+func TestRotateByFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotrack.log")
+	if err := os.WriteFile(path, []byte("old\n"), fileMode); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRotatingFile(path, RotateConfig{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("file holds %q, want it rotated before the write", b)
+	}
+}
@@ -2,12 +2,22 @@ package mail
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
 	"html/template"
 	"net/smtp"
-	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/metrics"
+	"github.com/NikoMalik/GoTrack/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:embed templates/*
@@ -35,6 +45,8 @@ type MailData struct {
 // MailJob is the unit of work to be performed when sending an email to chan
 type MailJob struct {
 	MailMessage MailData
+	// result receives the outcome of the send when it is set.
+	result chan error
 }
 
 type Worker struct {
@@ -42,6 +54,10 @@ type Worker struct {
 	JobQueue   chan MailJob
 	WorkerPool chan chan MailJob
 	QuitChan   chan bool
+
+	done    chan struct{}
+	pending *sync.WaitGroup
+	smtp    config.SMTP
 }
 
 func NewWorker(id int, workerPool chan chan MailJob) *Worker {
@@ -50,11 +66,13 @@ func NewWorker(id int, workerPool chan chan MailJob) *Worker {
 		JobQueue:   make(chan MailJob),
 		WorkerPool: workerPool,
 		QuitChan:   make(chan bool),
+		done:       make(chan struct{}),
 	}
 }
 
 func (w *Worker) Start() {
 	go func() {
+		defer close(w.done)
 		for {
 			w.WorkerPool <- w.JobQueue
 			select {
@@ -62,6 +80,15 @@ func (w *Worker) Start() {
 				err := w.processMailQueueJob(job.MailMessage)
 				if err != nil {
 					fmt.Printf("Error processing job: %v\n", err)
+					metrics.MailSent.WithLabelValues("failed").Inc()
+				} else {
+					metrics.MailSent.WithLabelValues("sent").Inc()
+				}
+				if job.result != nil {
+					job.result <- err
+				}
+				if w.pending != nil {
+					w.pending.Done()
 				}
 			case <-w.QuitChan:
 				fmt.Printf("worker%d stopping\n", w.ID)
@@ -71,17 +98,29 @@ func (w *Worker) Start() {
 	}()
 }
 
+// Stop stops the worker once its current job is done and waits for it to exit.
 func (w *Worker) Stop() {
-	go func() {
-		w.QuitChan <- true
-	}()
+	close(w.QuitChan)
+	<-w.done
 }
 
+// ErrQueueClosed is returned when a mail is sent after the dispatcher was shut down.
+var ErrQueueClosed = errors.New("mail queue is closed")
+
 // Dispatcher holds info for a dispatcher
 type Dispatcher struct {
 	workerPool chan chan MailJob
 	maxWorkers int
 	jobQueue   chan MailJob
+	workers    []*Worker
+	smtp       config.SMTP
+
+	mu      sync.RWMutex
+	closed  bool
+	pending sync.WaitGroup
+	queued  atomic.Int64
+	quitch  chan struct{}
+	donech  chan struct{}
 }
 
 // NewDispatcher creates, and returns a new Dispatcher object.
@@ -91,14 +130,99 @@ func NewDispatcher(jobQueue chan MailJob, maxWorkers int) *Dispatcher {
 		jobQueue:   jobQueue,
 		maxWorkers: maxWorkers,
 		workerPool: workerPool,
+		quitch:     make(chan struct{}),
+		donech:     make(chan struct{}),
+	}
+}
+
+// Start starts the workers and the dispatch loop.
+func (d *Dispatcher) Start() {
+	d.run()
+}
+
+// Send queues a mail for delivery.
+func (d *Dispatcher) Send(m MailData) error {
+	return d.send(MailJob{MailMessage: m})
+}
+
+// SendWait queues a mail and waits until the SMTP server accepted it. It
+// returns the error of the send, or the error of ctx when it is done
+// first; the mail may still go out then.
+func (d *Dispatcher) SendWait(ctx context.Context, m MailData) error {
+	result := make(chan error, 1)
+	if err := d.send(MailJob{MailMessage: m, result: result}); err != nil {
+		return err
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) send(job MailJob) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrQueueClosed
+	}
+	d.jobQueue <- job
+	return nil
+}
+
+// Len returns the number of mails waiting to be sent.
+func (d *Dispatcher) Len() int {
+	return len(d.jobQueue) + int(d.queued.Load())
+}
+
+// Cap returns the capacity of the job queue.
+func (d *Dispatcher) Cap() int {
+	return cap(d.jobQueue)
+}
+
+// Shutdown stops accepting mails, sends the ones already queued and stops
+// the workers. When ctx is done before the queue is empty it returns the
+// number of mails that were not sent.
+func (d *Dispatcher) Shutdown(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return 0, nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	close(d.quitch)
+	<-d.donech
+
+	waitch := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(waitch)
+	}()
+
+	select {
+	case <-waitch:
+	case <-ctx.Done():
+		return d.Len(), ctx.Err()
 	}
+
+	for _, w := range d.workers {
+		w.Stop()
+	}
+	return 0, nil
 }
 
 // run runs the workers
 func (d *Dispatcher) run() {
 	for i := 0; i < d.maxWorkers; i++ {
 		worker := NewWorker(i+1, d.workerPool)
+		worker.pending = &d.pending
+		worker.smtp = d.smtp
 		worker.Start()
+		d.workers = append(d.workers, worker)
 	}
 
 	go d.dispatch()
@@ -106,18 +230,48 @@ func (d *Dispatcher) run() {
 
 // dispatch dispatches worker
 func (d *Dispatcher) dispatch() {
+	defer close(d.donech)
 	for {
 		select {
 		case job := <-d.jobQueue:
-			go func() {
-				workerJobQueue := <-d.workerPool
-				workerJobQueue <- job
-			}()
+			d.enqueue(job)
+		case <-d.quitch:
+			// Hand the remaining queue over to the workers before returning.
+			for {
+				select {
+				case job := <-d.jobQueue:
+					d.enqueue(job)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
-func (w *Worker) processMailQueueJob(mail MailData) error {
+func (d *Dispatcher) enqueue(job MailJob) {
+	d.pending.Add(1)
+	d.queued.Add(1)
+	go func() {
+		workerJobQueue := <-d.workerPool
+		d.queued.Add(-1)
+		workerJobQueue <- job
+	}()
+}
+
+func (w *Worker) processMailQueueJob(mail MailData) (err error) {
+	_, span := tracing.Start(context.Background(), "mail.send", trace.WithAttributes(
+		attribute.String("mail.template", mail.Template),
+		attribute.Int("mail.recipients", len(mail.AdditionalTo)+1),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	var preferenceMap map[string]string
 
 	data := struct {
@@ -152,30 +306,27 @@ func (w *Worker) processMailQueueJob(mail MailData) error {
 		return fmt.Errorf("error executing template: %v", err)
 	}
 
-	sender := os.Getenv("SMTP_SENDER")
+	sender := w.smtp.Sender
 	if sender == "" {
 		return errors.New("smtp sender not provided")
 	}
 
-	smtpServer := os.Getenv("SMTP_SERVER")
+	smtpServer := w.smtp.Server
 	if smtpServer == "" {
 		return errors.New("smtp server not provided")
 	}
 
-	smtpUsername := os.Getenv("SMTP_USERNAME")
+	smtpUsername := w.smtp.Username
 	if smtpUsername == "" {
 		return errors.New("smtp username not provided")
 	}
 
-	smtpPassword := os.Getenv("SMTP_PASSWORD")
+	smtpPassword := w.smtp.Password
 	if smtpPassword == "" {
 		return errors.New("smtp password not provided")
 	}
 
-	smtpPort := os.Getenv("SMTP_PORT")
-	if smtpPort == "" {
-		smtpPort = "587" // default
-	}
+	smtpPort := strconv.Itoa(w.smtp.Port)
 
 	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpServer)
 
@@ -186,7 +337,7 @@ func (w *Worker) processMailQueueJob(mail MailData) error {
 		"Content-Type: text/html; charset=\"UTF-8\";\r\n\r\n" +
 		body.String())
 
-	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, sender, to, msg)
+	err = smtp.SendMail(smtpServer+":"+smtpPort, auth, sender, to, msg)
 	if err != nil {
 		return fmt.Errorf("error sending mail: %v", err)
 	}
@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NikoMalik/GoTrack/config"
+)
+
+var dispatcher *Dispatcher
+
+// ErrNotInitialized is returned by Send when Init was not called.
+var ErrNotInitialized = errors.New("mail dispatcher is not initialized")
+
+// Init starts the package-level dispatcher sending through the given SMTP
+// server with the configured amount of workers and queue size.
+func Init(smtp config.SMTP, cfg config.Mail) {
+	dispatcher = NewDispatcher(make(chan MailJob, cfg.QueueSize), cfg.Workers)
+	dispatcher.smtp = smtp
+	dispatcher.Start()
+}
+
+// Send queues a mail on the package-level dispatcher.
+func Send(m MailData) error {
+	if dispatcher == nil {
+		return ErrNotInitialized
+	}
+	return dispatcher.Send(m)
+}
+
+// SendWait sends a mail through the package-level dispatcher and waits for
+// the outcome, see Dispatcher.SendWait.
+func SendWait(ctx context.Context, m MailData) error {
+	if dispatcher == nil {
+		return ErrNotInitialized
+	}
+	return dispatcher.SendWait(ctx, m)
+}
+
+// Shutdown drains the package-level dispatcher, see Dispatcher.Shutdown.
+func Shutdown(ctx context.Context) (int, error) {
+	if dispatcher == nil {
+		return 0, nil
+	}
+	return dispatcher.Shutdown(ctx)
+}
+
+// QueueLen returns the number of queued mails and the capacity of the queue.
+func QueueLen() (int, int) {
+	if dispatcher == nil {
+		return 0, 0
+	}
+	return dispatcher.Len(), dispatcher.Cap()
+}
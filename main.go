@@ -1,27 +1,40 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"html/template"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime/debug"
 	"syscall"
 	"time"
 
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/data"
 	"github.com/NikoMalik/GoTrack/db"
+	"github.com/NikoMalik/GoTrack/event"
+	"github.com/NikoMalik/GoTrack/handlers"
+	"github.com/NikoMalik/GoTrack/lifecycle"
 	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/mail"
+	"github.com/NikoMalik/GoTrack/metrics"
 	"github.com/NikoMalik/GoTrack/middleware"
+	"github.com/NikoMalik/GoTrack/monitor"
 	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/NikoMalik/GoTrack/tracing"
 
 	"github.com/NikoMalik/GoTrack/router"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
 )
 
 // var store = session.New()
@@ -37,6 +50,23 @@ var wsClient Client
 // const maxWorkerPoolSize = 5
 // const maxJobMaxWorkers = 5
 
+var shutdownTracing func(context.Context) error
+
+var (
+	configPath  = flag.String("config", os.Getenv("GO_TRACK_CONFIG"), "path to a YAML or TOML config file")
+	autoMigrate = flag.Bool("auto-migrate", false, "apply pending migrations before serving (for development)")
+)
+
+const usage = `Usage: gotrack [flags] [command]
+
+Commands:
+  serve                            run the web server (default)
+  migrate up|down|redo|status      manage the database schema
+  seed                             insert the built-in service types and demo data
+
+Flags:
+`
+
 var app = fiber.New(fiber.Config{
 
 	JSONEncoder: json.Marshal,
@@ -72,13 +102,66 @@ func main() {
 			debug.PrintStack()
 		}
 	}()
-	initEverything()
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd, args := "serve", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	// Flags may also follow the command.
+	if err := flag.CommandLine.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	args = flag.Args()
+
+	switch cmd {
+	case "serve":
+		serve()
+	case "migrate":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		initDB()
+		if err := db.Migrate(context.Background(), args[0], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "seed":
+		initDB()
+		if err := db.Seed(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Database seeded")
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// serve runs the web server until SIGINT or SIGTERM.
+func serve() {
+	cfg := initEverything()
 	app.Static("static", "./static", fiber.Static{
 		Compress:      true,
 		CacheDuration: 0,
 	})
 
 	app.Use(logger.New())
+	app.Use(tracing.Middleware)
+	app.Use(logEvent.Middleware)
+	app.Use(metrics.Middleware)
+
+	router.SetupProbes(app)
+	switch {
+	case cfg.Metrics.Addr == "" && cfg.Metrics.Token != "":
+		app.Get("/metrics", metrics.Handler(cfg.Metrics.Token))
+	case cfg.Metrics.Addr == "":
+		logEvent.Warn("metrics are disabled, set METRICS_TOKEN to serve /metrics or METRICS_ADDR to serve it on a listener of its own")
+	}
 
 	// app.Use(jwtware.New(jwtware.Config{
 	// 	SigningKey: jwtware.SigningKey{
@@ -94,7 +177,9 @@ func main() {
 		},
 	}))
 
-	app.Use(middleware.WithAuthUser)
+	app.Use(middleware.CSRF())
+	app.Use(middleware.OptionalAuth)
+	app.Use(handlers.WithAccount)
 
 	// app.Use(func(c *fiber.Ctx) error {
 	// 	c.Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
@@ -106,29 +191,198 @@ func main() {
 	// Set up routes
 	router.Setup(app)
 
-	go func() {
-		ch := make(chan os.Signal, 1)
-		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-		<-ch
-		fmt.Println("Shutting down server...")
+	// Components are drained in registration order: stop intake first,
+	// then flush the queues the remaining work ends up in.
+	lifecycle.Register("http", func(ctx context.Context) (int, error) {
+		return 0, app.ShutdownWithContext(ctx)
+	})
+	if cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.HTTPHandler(cfg.Metrics.Token))
+		srv := &http.Server{Addr: cfg.Metrics.Addr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+		lifecycle.Register("metrics", func(ctx context.Context) (int, error) {
+			return 0, srv.Shutdown(ctx)
+		})
+	}
+	lifecycle.Register("monitor", monitor.Shutdown)
+	lifecycle.Register("event", event.Drain)
+	lifecycle.Register("outbox", func(ctx context.Context) (int, error) {
+		return 0, event.StopRelay(ctx)
+	})
+	lifecycle.Register("mail", mail.Shutdown)
+	lifecycle.Register("db", func(ctx context.Context) (int, error) {
+		return 0, db.Bun.Close()
+	})
+	lifecycle.Register("tracing", func(ctx context.Context) (int, error) {
+		return 0, shutdownTracing(ctx)
+	})
+	lifecycle.Register("log", func(ctx context.Context) (int, error) {
+		return 0, logEvent.Close()
+	})
 
-		if err := app.Shutdown(); err != nil {
-			log.Fatalf("Error during shutdown: %v", err)
+	// Start the server
+	go func() {
+		if err := app.Listen(cfg.HTTP.Addr); err != nil {
+			log.Fatal(err)
 		}
 	}()
 
-	// Start the server
-	log.Fatal(app.Listen(":8000"))
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	<-ch
+	fmt.Println("Shutting down server...")
+
+	report := lifecycle.Shutdown(cfg.HTTP.ShutdownTimeout)
+	fmt.Print(report)
+}
+
+// initDB loads the configuration and connects to the database, which is all
+// the migrate and seed commands need.
+func initDB() *config.Config {
+	cfg, err := config.Init(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db.Init(cfg.DB)
+	return cfg
+}
+
+func initEverything() *config.Config {
+	cfg, err := config.Init(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shutdownTracing, err = tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sb.Init(cfg.Supabase); err != nil {
+		log.Fatal(err)
+	}
+	db.Init(cfg.DB)
+	if *autoMigrate {
+		if err := db.Migrate(context.Background(), "up", os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Tracing.Enabled {
+		db.Bun.AddQueryHook(tracing.QueryHook{})
+	}
+	logEvent.Init(cfg.Log)
+	if err := data.SetSessionKey(cfg.Auth.SessionKeyBytes()); err != nil {
+		log.Fatal(err)
+	}
+	repos := data.NewBunRepos(db.Bun)
+	handlers.Init(repos)
+	middleware.Init(repos.Sessions, repos.APIKeys)
+	if cfg.Event.Outbox {
+		event.StartRelay(db.Bun, event.DefaultRelayConfig)
+	}
+	mail.Init(cfg.SMTP, cfg.Mail)
+	subscribeMail()
+	monitor.StartSync(repos.HostServices, time.Minute)
+	monitor.Start()
+
+	metrics.RegisterQueue("event", event.Len)
+	metrics.RegisterQueue("mail", func() int {
+		n, _ := mail.QueueLen()
+		return n
+	})
+	return cfg
+}
+
+// subscribeMail sends the mails of application events. Events arrive
+// in-memory, or through the outbox when it is enabled; those are only
+// acknowledged once the SMTP server accepted the mail.
+func subscribeMail() {
+	event.Subscribe(data.InvitationCreatedEvent, func(ctx context.Context, v any) {
+		if inv, ok := v.(data.InvitationCreated); ok {
+			if err := mail.Send(invitationMail(inv)); err != nil {
+				logEvent.Error("queue invitation mail", "error", err)
+			}
+		}
+	})
+	event.SubscribeDurable(data.InvitationCreatedEvent, func(ctx context.Context, env *event.Envelope) error {
+		var inv data.InvitationCreated
+		if err := env.Decode(&inv); err != nil {
+			return err
+		}
+		return mail.SendWait(ctx, invitationMail(inv))
+	})
+	event.Subscribe(data.ResendVerificationEvent, func(ctx context.Context, v any) {
+		if req, ok := v.(data.VerificationRequested); ok {
+			if err := mail.Send(verificationMail(req)); err != nil {
+				logEvent.Error("queue verification mail", "error", err)
+			}
+		}
+	})
+	event.SubscribeDurable(data.ResendVerificationEvent, func(ctx context.Context, env *event.Envelope) error {
+		var req data.VerificationRequested
+		if err := env.Decode(&req); err != nil {
+			return err
+		}
+		return mail.SendWait(ctx, verificationMail(req))
+	})
+	event.Subscribe(data.PasswordResetEvent, func(ctx context.Context, v any) {
+		if req, ok := v.(data.PasswordResetRequested); ok {
+			if err := mail.Send(passwordResetMail(req)); err != nil {
+				logEvent.Error("queue password reset mail", "error", err)
+			}
+		}
+	})
+	event.SubscribeDurable(data.PasswordResetEvent, func(ctx context.Context, env *event.Envelope) error {
+		var req data.PasswordResetRequested
+		if err := env.Decode(&req); err != nil {
+			return err
+		}
+		return mail.SendWait(ctx, passwordResetMail(req))
+	})
+}
+
+func verificationMail(req data.VerificationRequested) mail.MailData {
+	return mail.MailData{
+		ToName:    req.Name,
+		ToAddress: req.Email,
+		Subject:   "Verify your email address for GoTrack",
+		Content: template.HTML(fmt.Sprintf(
+			`<p>Please <a href="%s">verify your email address</a>. The link is valid until %s UTC.</p><p>If you didn't sign up for GoTrack, ignore this mail.</p>`,
+			html.EscapeString(req.URL),
+			req.ExpiresAt.UTC().Format("January 2, 2006 15:04"),
+		)),
+	}
+}
+
+func passwordResetMail(req data.PasswordResetRequested) mail.MailData {
+	return mail.MailData{
+		ToName:    req.Name,
+		ToAddress: req.Email,
+		Subject:   "Reset your GoTrack password",
+		Content: template.HTML(fmt.Sprintf(
+			`<p>Someone asked to reset the password of your GoTrack account. <a href="%s">Choose a new password</a> before %s UTC.</p><p>If it wasn't you, ignore this mail, your password stays the same.</p>`,
+			html.EscapeString(req.URL),
+			req.ExpiresAt.UTC().Format("January 2, 2006 15:04"),
+		)),
+	}
 }
 
-func initEverything() error {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file")
-		return err
+func invitationMail(inv data.InvitationCreated) mail.MailData {
+	return mail.MailData{
+		ToAddress: inv.Invitation.Email,
+		Subject:   "You have been invited to " + inv.AccountName + " on GoTrack",
+		Content: template.HTML(fmt.Sprintf(
+			`<p>%s invited you to join %s on GoTrack.</p><p><a href="%s">Accept the invitation</a> before %s.</p>`,
+			html.EscapeString(inv.InviterEmail),
+			html.EscapeString(inv.AccountName),
+			html.EscapeString(inv.URL),
+			inv.Invitation.ExpiresAt.UTC().Format("January 2, 2006"),
+		)),
 	}
-	sb.Init()
-	db.Init()
-	defer db.Bun.Close()
-	logEvent.Init("GO_TRACK_LOG")
-	return nil
 }
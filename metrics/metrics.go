@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gotrack"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	})
+
+	// MailSent counts mail deliveries by outcome ("sent" or "failed").
+	MailSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Number of mails processed by outcome.",
+	}, []string{"outcome"})
+
+	// SchedulerLag observes how late a check started compared to its schedule.
+	SchedulerLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scheduler_lag_seconds",
+		Help:      "Delay between the scheduled and the actual start of a check.",
+		Buckets:   []float64{.001, .01, .1, .5, 1, 5, 15, 60},
+	})
+
+	// serviceLabels identify a monitored service. The id keeps series of
+	// services with the same host and service name apart.
+	serviceLabels = []string{"account_id", "host_service_id", "host", "service"}
+
+	serviceUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_up",
+		Help:      "Whether the last check of a monitored service succeeded (1) or not (0).",
+	}, serviceLabels)
+
+	serviceResponse = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "service_response_seconds",
+		Help:      "Response time of monitored services.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, serviceLabels)
+
+	serviceCertExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "service_certificate_expiry_timestamp_seconds",
+		Help:      "Unix time at which the TLS certificate of a monitored service expires.",
+	}, serviceLabels)
+)
+
+// RegisterQueue exports the depth of a queue, read from fn on every scrape.
+func RegisterQueue(name string, fn func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth",
+		Help:        "Number of items waiting in an internal queue.",
+		ConstLabels: prometheus.Labels{"queue": name},
+	}, func() float64 {
+		return float64(fn())
+	})
+}
+
+// ObserveService records the outcome of a check of a monitored service.
+// A zero certExpiry leaves the certificate gauge untouched.
+func ObserveService(accountID int64, hostServiceID int, host, service string, up bool, responseTime time.Duration, certExpiry time.Time) {
+	labels := []string{strconv.FormatInt(accountID, 10), strconv.Itoa(hostServiceID), host, service}
+	v := 0.0
+	if up {
+		v = 1
+	}
+	serviceUp.WithLabelValues(labels...).Set(v)
+	serviceResponse.WithLabelValues(labels...).Observe(responseTime.Seconds())
+	if !certExpiry.IsZero() {
+		serviceCertExpiry.WithLabelValues(labels...).Set(float64(certExpiry.Unix()))
+	}
+}
+
+// ForgetService removes the series of a service that is no longer
+// monitored, or whose host or service name changed.
+func ForgetService(hostServiceID int) {
+	labels := prometheus.Labels{"host_service_id": strconv.Itoa(hostServiceID)}
+	serviceUp.DeletePartialMatch(labels)
+	serviceResponse.DeletePartialMatch(labels)
+	serviceCertExpiry.DeletePartialMatch(labels)
+}
+
+// Middleware records request count, duration and in-flight requests.
+// The route pattern is used as label to keep the cardinality bounded.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	httpInFlight.Inc()
+	defer httpInFlight.Dec()
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else {
+			status = fiber.StatusInternalServerError
+		}
+	}
+
+	route := c.Route().Path
+	method := c.Method()
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// Handler serves the metrics in the Prometheus text format to requests
+// that carry token as bearer token.
+func Handler(token string) fiber.Handler {
+	return adaptor.HTTPHandler(HTTPHandler(token))
+}
+
+// HTTPHandler is Handler for a server of its own. An empty token lets every
+// request through, which is only meant for a listener that isn't public.
+func HTTPHandler(token string) http.Handler {
+	h := promhttp.Handler()
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
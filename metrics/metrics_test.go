@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHTTPHandlerToken(t *testing.T) {
+	h := HTTPHandler("s3cret")
+	for auth, want := range map[string]int{
+		"":               http.StatusUnauthorized,
+		"Bearer guess":   http.StatusUnauthorized,
+		"Bearer s3cret":  http.StatusOK,
+		"Basic s3cret":   http.StatusUnauthorized,
+		"Bearer s3cret ": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Authorization %q: status %d, want %d", auth, rec.Code, want)
+		}
+	}
+}
+
+func TestObserveServiceLabels(t *testing.T) {
+	ObserveService(1, 7, "example.com", "https", true, 0, time.Time{})
+	if v := testutil.ToFloat64(serviceUp.WithLabelValues("1", "7", "example.com", "https")); v != 1 {
+		t.Errorf("service_up = %v, want 1", v)
+	}
+	ForgetService(7)
+	if n := testutil.CollectAndCount(serviceUp); n != 0 {
+		t.Errorf("%d series left after ForgetService", n)
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/gofiber/fiber/v2"
+)
+
+var apiKeys data.APIKeyRepo
+
+type apiKeyKey struct{}
+
+// APIKey returns the API key the request authenticated with, or nil.
+func APIKey(c *fiber.Ctx) *data.APIKey {
+	k, _ := c.Locals(apiKeyKey{}).(*data.APIKey)
+	return k
+}
+
+// bearerToken returns the API key of the Authorization header, if any.
+func bearerToken(c *fiber.Ctx) string {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateKey returns the user an API key acts as. Keys only work for
+// the API, so they can't be used to manage the account or other keys.
+// Personal keys act as their owner, organization keys as no one in
+// particular.
+func authenticateKey(c *fiber.Ctx, actor data.Actor, secret string) *data.AuthenticatedUser {
+	l := logEvent.FromCtx(c)
+	if !strings.HasPrefix(c.Path(), "/api/") {
+		l.Debug("api key outside of the api")
+		return nil
+	}
+	k, err := apiKeys.GetByHash(c.UserContext(), data.APIKeyHash(secret))
+	if err != nil {
+		l.Debug("invalid api key", "error", err)
+		return nil
+	}
+
+	// Saving every use would write on each request.
+	now := time.Now()
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) > touchEvery || k.LastUsedIP != c.IP() {
+		if err := apiKeys.Touch(c.UserContext(), k.ID, c.IP(), now); err != nil {
+			l.Error("touch api key", "error", err)
+		}
+	}
+
+	user := &data.AuthenticatedUser{ID: k.UserID, Name: k.Name, LoggedIn: true}
+	actor.UserID, actor.Email = k.UserID, "api key "+k.Prefix
+	c.SetUserContext(data.WithActor(c.UserContext(), actor))
+	logEvent.SetCtx(c, l.With("user_id", k.UserID, "key_prefix", k.Prefix))
+	c.Locals(apiKeyKey{}, k)
+	SetUser(c, user)
+	return user
+}
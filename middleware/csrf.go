@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/csrf"
+)
+
+const (
+	// CSRFField is the form field classic forms send the CSRF token in.
+	CSRFField = "_csrf"
+	// CSRFHeader is the header htmx sends the CSRF token in.
+	CSRFHeader = csrf.HeaderName
+)
+
+type csrfKey struct{}
+
+// CSRF turns away unsafe requests that don't carry the token of the
+// "csrf_" cookie in CSRFHeader or CSRFField, the double submit pattern.
+// API requests with a key are exempt: browsers never add the
+// Authorization header to cross-site requests.
+func CSRF() fiber.Handler {
+	return csrf.New(csrf.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), "/api/") && bearerToken(c) != ""
+		},
+		Extractor:      csrfToken,
+		CookieName:     "csrf_",
+		CookieSecure:   true,
+		CookieHTTPOnly: true,
+		CookieSameSite: "Lax",
+		Expiration:     12 * time.Hour,
+		ContextKey:     csrfKey{},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			logEvent.FromCtx(c).Warn("csrf check failed", "path", c.Path(), "error", err)
+			return fiber.ErrForbidden
+		},
+	})
+}
+
+// csrfToken returns the token of the header, or else of the form.
+func csrfToken(c *fiber.Ctx) (string, error) {
+	if token := c.Get(CSRFHeader); token != "" {
+		return token, nil
+	}
+	if token := c.FormValue(CSRFField); token != "" {
+		return token, nil
+	}
+	return "", csrf.ErrTokenNotFound
+}
+
+// CSRFToken returns the CSRF token of a request context, for templates.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCSRF(t *testing.T) {
+	app := fiber.New()
+	app.Use(CSRF())
+	app.Get("/auth/login", func(c *fiber.Ctx) error {
+		return c.SendString(CSRFToken(c.Context()))
+	})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Post("/auth/login", ok)
+	app.Post("/api/hosts", ok)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/auth/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cookie *http.Cookie
+	for _, ck := range resp.Cookies() {
+		if ck.Name == "csrf_" {
+			cookie = ck
+		}
+	}
+	if cookie == nil || cookie.Value == "" {
+		t.Fatal("no csrf cookie")
+	}
+	if b, _ := io.ReadAll(resp.Body); string(b) != cookie.Value {
+		t.Errorf("template token %q, cookie %q", b, cookie.Value)
+	}
+
+	post := func(target string, form url.Values, header http.Header, withCookie bool) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if withCookie {
+			req.AddCookie(cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		form       url.Values
+		header     http.Header
+		withCookie bool
+		status     int
+	}{
+		{"form token", "/auth/login", url.Values{CSRFField: {cookie.Value}}, nil, true, fiber.StatusNoContent},
+		{"htmx header", "/auth/login", nil, http.Header{CSRFHeader: {cookie.Value}}, true, fiber.StatusNoContent},
+		{"no token", "/auth/login", nil, nil, true, fiber.StatusForbidden},
+		{"token without cookie", "/auth/login", url.Values{CSRFField: {cookie.Value}}, nil, false, fiber.StatusForbidden},
+		{"wrong token", "/auth/login", url.Values{CSRFField: {"guess"}}, nil, true, fiber.StatusForbidden},
+		{"api key", "/api/hosts", nil, http.Header{fiber.HeaderAuthorization: {"Bearer gt_key"}}, false, fiber.StatusNoContent},
+		{"api key outside the api", "/auth/login", nil, http.Header{fiber.HeaderAuthorization: {"Bearer gt_key"}}, false, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status := post(tt.target, tt.form, tt.header, tt.withCookie); status != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.status)
+		}
+	}
+}
@@ -1,84 +1,127 @@
 package middleware
 
 import (
-	"log"
+	"context"
 	"strings"
-	"sync"
 
 	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
 	"github.com/NikoMalik/GoTrack/sb"
 	"github.com/gofiber/fiber/v2"
 )
 
-var (
-	authenticatedUser *data.AuthenticatedUser // auth userModel &
-	mu                sync.RWMutex            // mutex for escape data race
-)
+// userKey stores the signed in user in the locals of a request. Fiber
+// locals are the values of the request context, so templates can read the
+// user from their ctx too.
+type userKey struct{}
 
-// WithAuthUser is a middleware that checks for a valid user in the "access_Token" cookie.
-func WithAuthUser(c *fiber.Ctx) error {
-	// Skip middleware for public paths
-	if strings.Contains(c.Path(), "/static") {
+// checkedKey marks a request whose cookie was already verified.
+type checkedKey struct{}
+
+// OptionalAuth loads the user of the "access_Token" cookie or of an API
+// key in the Authorization header, if any, and lets every request through.
+// The access token of a session is refreshed transparently before it
+// expires.
+func OptionalAuth(c *fiber.Ctx) error {
+	authenticate(c)
+	return c.Next()
+}
+
+// RequireAuth loads the user like OptionalAuth and turns away
+// anonymous requests: API requests get 401, pages redirect to the login.
+func RequireAuth(c *fiber.Ctx) error {
+	if user := authenticate(c); user != nil {
 		return c.Next()
 	}
+	if strings.HasPrefix(c.Path(), "/api/") || c.Accepts(fiber.MIMETextHTML) == "" {
+		return fiber.ErrUnauthorized
+	}
+	if c.Get("HX-Request") != "" {
+		c.Set("HX-Redirect", "/auth/login")
+		return c.SendStatus(fiber.StatusFound)
+	}
+	return c.Redirect("/auth/login", fiber.StatusFound)
+}
 
-	// Get the cookie "access_Token"
-	cookie := c.Cookies("access_Token")
-	if cookie == "" {
-		clearAuthenticatedUser()
-		return c.Next()
+// User returns the signed in user of the request, or nil.
+func User(c *fiber.Ctx) *data.AuthenticatedUser {
+	user, _ := c.Locals(userKey{}).(*data.AuthenticatedUser)
+	return user
+}
+
+// UserFrom returns the signed in user of a request context, or nil. Use it
+// where only the context is at hand, like in templates.
+func UserFrom(ctx context.Context) *data.AuthenticatedUser {
+	user, _ := ctx.Value(userKey{}).(*data.AuthenticatedUser)
+	return user
+}
+
+// SetUser makes user the signed in user of the request.
+func SetUser(c *fiber.Ctx, user *data.AuthenticatedUser) {
+	c.Locals(userKey{}, user)
+	c.SetUserContext(context.WithValue(c.UserContext(), userKey{}, user))
+}
+
+// authenticate verifies the "access_Token" cookie, refreshed through the
+// session if needed, once per request and returns its user, or nil. The
+// token has to belong to the signed in session of the request.
+func authenticate(c *fiber.Ctx) *data.AuthenticatedUser {
+	if user := User(c); user != nil || c.Locals(checkedKey{}) != nil {
+		return user
+	}
+	c.Locals(checkedKey{}, true)
+	// Skip authentication for public paths
+	if strings.Contains(c.Path(), "/static") {
+		return nil
+	}
+
+	// Attribute audited actions to the client, and to the user once known.
+	actor := data.Actor{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	c.SetUserContext(data.WithActor(c.UserContext(), actor))
+
+	// Scripts send an API key instead of cookies.
+	if secret := bearerToken(c); secret != "" {
+		return authenticateKey(c, actor, secret)
 	}
 
-	// Verify user through Supabase
-	resp, err := sb.Client.Auth.User(c.Context(), cookie)
+	// Refresh the access token of the session before it expires.
+	sess, token := session(c, c.Cookies(accessCookie))
+	if token == "" {
+		return nil
+	}
+
+	// Verify the token locally, see sb.VerifyToken.
+	claims, err := sb.VerifyToken(c.UserContext(), token)
 	if err != nil {
-		clearAuthenticatedUser()
-		return c.Next()
+		logEvent.FromCtx(c).Debug("invalid access token", "error", err)
+		return nil
+	}
+	if sess == nil || sess.UserID != claims.Subject {
+		return nil
 	}
+	c.Locals(sessionKey{}, sess)
 
-	// Initialize user information
 	user := &data.AuthenticatedUser{
+		ID:       claims.Subject,
+		Email:    claims.Email,
 		LoggedIn: true,
 	}
 
 	// Safe extraction of Name from UserMetadata
-	if name, ok := resp.UserMetadata["Name"].(string); ok {
+	if name, ok := claims.UserMetadata["Name"].(string); ok {
 		user.Name = name
 	} else {
 		// Handle the case where Name is not a string or is missing
 		user.Name = "Unknown"
 	}
 
-	// Extract Email safely
-	user.Email = resp.Email
+	actor.UserID, actor.Email = user.ID, user.Email
+	c.SetUserContext(data.WithActor(c.UserContext(), actor))
 
-	log.Println("User authenticated:", user.Email)
-
-	// Store user in context and package-level variable
-	c.Locals("user", user)
-	setAuthenticatedUser(user)
-
-	// Proceed to the next handler
-	return c.Next()
-}
-
-// setAuthenticatedUser safely sets the authenticated user
-func setAuthenticatedUser(user *data.AuthenticatedUser) {
-	mu.Lock()
-	defer mu.Unlock()
-	authenticatedUser = user
-}
-
-// clearAuthenticatedUser safely clears the authenticated user
-func clearAuthenticatedUser() {
-	mu.Lock()
-	defer mu.Unlock()
-	authenticatedUser = &data.AuthenticatedUser{}
-}
+	l := logEvent.FromCtx(c).With("user_id", user.ID)
+	logEvent.SetCtx(c, l)
+	l.Debug("user authenticated")
 
-// GetAuthenticatedUser safely retrieves the authenticated user
-func GetAuthenticatedUser() *data.AuthenticatedUser {
-	mu.RLock()
-	defer mu.RUnlock()
-	return authenticatedUser
+	SetUser(c, user)
+	return user
 }
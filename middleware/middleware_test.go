@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRequireAuth(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if id := c.Get("X-User"); id != "" {
+			SetUser(c, &data.AuthenticatedUser{ID: id, LoggedIn: true})
+		}
+		return c.Next()
+	}, RequireAuth)
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(UserFrom(c.UserContext()).ID)
+	}
+	app.Get("/api/hosts", handler)
+	app.Get("/hosts", handler)
+
+	tests := []struct {
+		target, user string
+		status       int
+	}{
+		{"/api/hosts", "", fiber.StatusUnauthorized},
+		{"/hosts", "", fiber.StatusFound},
+		{"/hosts", "u1", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Header.Set("X-User", tt.user)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s as %q: status = %d, want %d", tt.target, tt.user, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestAuthenticateNeedsSession(t *testing.T) {
+	cfg := config.Supabase{
+		URL:         "https://project.supabase.co",
+		Key:         "key",
+		JWTSecret:   "secret",
+		JWKSRefresh: time.Hour,
+		Audience:    "authenticated",
+	}
+	if err := sb.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "u1",
+		Issuer:    cfg.AuthURL(),
+		Audience:  jwt.ClaimStrings{"authenticated"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(cfg.JWTSecret))
+
+	repos := memory.NewRepos(memory.NewStore())
+	Init(repos.Sessions, repos.APIKeys)
+	newSession := func(userID string, pending bool) string {
+		sess, secret := data.NewSession(userID, "refresh", "0.0.0.0", "test")
+		sess.Pending = pending
+		if err := repos.Sessions.Create(context.Background(), sess); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if user := authenticate(c); user != nil {
+			return c.SendString(user.ID)
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name, session, want string
+	}{
+		{"signed in", newSession("u1", false), "u1"},
+		{"no session", "", ""},
+		{"unknown session", "guess", ""},
+		{"pending session", newSession("u1", true), ""},
+		{"session of another user", newSession("u2", false), ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, accessCookie+"="+token+"; "+sessionCookie+"="+tt.session)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := io.ReadAll(resp.Body); string(b) != tt.want {
+			t.Errorf("%s: signed in %q, want %q", tt.name, b, tt.want)
+		}
+	}
+}
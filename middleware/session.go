@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/sb"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nedpals/supabase-go"
+)
+
+const (
+	accessCookie  = "access_Token"
+	sessionCookie = "session"
+	// refreshBefore is how long before its expiry an access token is
+	// refreshed.
+	refreshBefore = 2 * time.Minute
+	// touchEvery limits how often the last seen time of a session is saved.
+	touchEvery = 5 * time.Minute
+	// pendingTimeout is how long a user has to enter their second factor.
+	pendingTimeout = 10 * time.Minute
+)
+
+var sessions data.SessionRepo
+
+// refreshUser exchanges a refresh token for new tokens. Tests replace it.
+var refreshUser = func(ctx context.Context, accessToken, refreshToken string) (*supabase.AuthenticatedDetails, error) {
+	return sb.Client.Auth.RefreshUser(ctx, accessToken, refreshToken)
+}
+
+type (
+	sessionKey struct{}
+	pendingKey struct{}
+)
+
+// Init sets the repositories sessions and API keys are stored in.
+func Init(sessionRepo data.SessionRepo, keyRepo data.APIKeyRepo) {
+	sessions, apiKeys = sessionRepo, keyRepo
+}
+
+// CurrentSession returns the session of the request, or nil when nobody
+// is signed in or the request uses an API key.
+func CurrentSession(c *fiber.Ctx) *data.Session {
+	sess, _ := c.Locals(sessionKey{}).(*data.Session)
+	return sess
+}
+
+// StartSession stores the tokens of a sign in: the refresh token in a new
+// session on the server, the access token and the session token in cookies.
+func StartSession(c *fiber.Ctx, details *supabase.AuthenticatedDetails) error {
+	sess, token := data.NewSession(details.User.ID, details.RefreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err := sessions.Create(c.UserContext(), sess); err != nil {
+		return err
+	}
+	setCookies(c, details.AccessToken, token)
+	return nil
+}
+
+// StartPendingSession starts a session that waits for the second factor
+// of the user. Until CompleteSession the browser only gets the session
+// token, not the access token.
+func StartPendingSession(c *fiber.Ctx, details *supabase.AuthenticatedDetails) error {
+	sess, token := data.NewSession(details.User.ID, details.RefreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	sess.Pending = true
+	if err := sessions.Create(c.UserContext(), sess); err != nil {
+		return err
+	}
+	c.ClearCookie(accessCookie)
+	setSessionCookie(c, token)
+	return nil
+}
+
+// PendingSession returns the pending session of the request, or nil.
+func PendingSession(c *fiber.Ctx) *data.Session {
+	sess, _ := c.Locals(pendingKey{}).(*data.Session)
+	return sess
+}
+
+// CompleteSession signs the user of the pending session of the request in,
+// once they passed their second factor.
+func CompleteSession(c *fiber.Ctx) error {
+	sess := PendingSession(c)
+	if sess == nil {
+		return fiber.ErrUnauthorized
+	}
+	details, err := refreshUser(c.UserContext(), "", sess.RefreshToken)
+	if err != nil {
+		return err
+	}
+	sess.Pending, sess.RefreshToken, sess.LastSeenAt = false, details.RefreshToken, time.Now()
+	if err := sessions.Update(c.UserContext(), sess); err != nil {
+		return err
+	}
+	c.Locals(pendingKey{}, nil)
+	setCookies(c, details.AccessToken, c.Cookies(sessionCookie))
+	return nil
+}
+
+// EndSession revokes the session of the request, pending or not, and
+// clears the cookies.
+func EndSession(c *fiber.Ctx) error {
+	sess := CurrentSession(c)
+	if sess == nil {
+		sess = PendingSession(c)
+	}
+	if sess != nil {
+		err := sessions.Revoke(c.UserContext(), sess.UserID, sess.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	c.ClearCookie(accessCookie, sessionCookie)
+	return nil
+}
+
+// session loads the session of the request and returns a fresh access
+// token for it. An access token only signs in together with its session,
+// so revoking the session ends the sign in: requests without a session
+// get no token, and the cookies of revoked or expired sessions are
+// cleared. Pending sessions are only kept for PendingSession and return no
+// token.
+func session(c *fiber.Ctx, token string) (*data.Session, string) {
+	secret := c.Cookies(sessionCookie)
+	if secret == "" {
+		return nil, ""
+	}
+	l := logEvent.FromCtx(c)
+	sess, err := sessions.Get(c.UserContext(), data.SessionID(secret))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			l.Error("load session", "error", err)
+			return nil, ""
+		}
+		c.ClearCookie(accessCookie, sessionCookie)
+		return nil, ""
+	}
+
+	now := time.Now()
+	if sess.Pending {
+		if now.Sub(sess.CreatedAt) > pendingTimeout {
+			c.ClearCookie(accessCookie, sessionCookie)
+			return nil, ""
+		}
+		c.Locals(pendingKey{}, sess)
+		return nil, ""
+	}
+	dirty := false
+	if expiresSoon(token, now) {
+		details, err := refreshUser(c.UserContext(), token, sess.RefreshToken)
+		if err != nil {
+			// Keep the session, Supabase may just be unavailable.
+			l.Warn("refresh access token", "error", err)
+		} else {
+			token, sess.RefreshToken, dirty = details.AccessToken, details.RefreshToken, true
+			setCookies(c, token, secret)
+		}
+	}
+	if now.Sub(sess.LastSeenAt) > touchEvery || sess.IP != c.IP() {
+		sess.LastSeenAt, sess.IP, sess.UserAgent, dirty = now, c.IP(), c.Get(fiber.HeaderUserAgent), true
+	}
+	if dirty {
+		if err := sessions.Update(c.UserContext(), sess); err != nil {
+			l.Error("update session", "error", err)
+		}
+	}
+	return sess, token
+}
+
+// expiresSoon reports whether token is missing or expires within
+// refreshBefore. The signature is checked later, by sb.VerifyToken.
+func expiresSoon(token string, now time.Time) bool {
+	if token == "" {
+		return true
+	}
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == nil {
+		return true
+	}
+	return claims.ExpiresAt.Time.Before(now.Add(refreshBefore))
+}
+
+func setCookies(c *fiber.Ctx, accessToken, sessionToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     accessCookie,
+		Value:    accessToken,
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+	setSessionCookie(c, sessionToken)
+}
+
+func setSessionCookie(c *fiber.Ctx, sessionToken string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionToken,
+		Expires:  time.Now().Add(data.SessionIdleTimeout),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Strict",
+	})
+}
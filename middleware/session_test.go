@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nedpals/supabase-go"
+)
+
+func TestSessionRefresh(t *testing.T) {
+	repos := memory.NewRepos(memory.NewStore())
+	Init(repos.Sessions, repos.APIKeys)
+	sess, secret := data.NewSession("u1", "refresh-1", "10.0.0.1", "test")
+	if err := repos.Sessions.Create(context.Background(), sess); err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(exp time.Duration) string {
+		s, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Subject:   "u1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+		}).SignedString([]byte("secret"))
+		return s
+	}
+	fresh := token(time.Hour)
+	defer func(f func(context.Context, string, string) (*supabase.AuthenticatedDetails, error)) { refreshUser = f }(refreshUser)
+	refreshUser = func(ctx context.Context, accessToken, refreshToken string) (*supabase.AuthenticatedDetails, error) {
+		if refreshToken != "refresh-1" {
+			t.Errorf("refresh token = %q", refreshToken)
+		}
+		return &supabase.AuthenticatedDetails{AccessToken: fresh, RefreshToken: "refresh-2"}, nil
+	}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, tok := session(c, c.Cookies(accessCookie))
+		return c.SendString(tok)
+	})
+	get := func(access string) (string, []string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, accessCookie+"="+access+"; "+sessionCookie+"="+secret)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), resp.Header.Values(fiber.HeaderSetCookie)
+	}
+
+	// A token that is still valid for long is used as is.
+	valid := token(30 * time.Minute)
+	if tok, cookies := get(valid); tok != valid || len(cookies) != 0 {
+		t.Errorf("valid token: got %q, cookies %v", tok, cookies)
+	}
+
+	// One about to expire is refreshed and the refresh token rotated.
+	tok, cookies := get(token(time.Minute))
+	if tok != fresh || len(cookies) != 2 || !strings.Contains(cookies[0], fresh) {
+		t.Errorf("expiring token: got %q, cookies %v", tok, cookies)
+	}
+	if got, _ := repos.Sessions.Get(context.Background(), sess.ID); got.RefreshToken != "refresh-2" {
+		t.Errorf("refresh token = %q, want it rotated", got.RefreshToken)
+	}
+
+	// Without its session an access token signs nobody in.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, accessCookie+"="+valid)
+	if resp, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	} else if b, _ := io.ReadAll(resp.Body); len(b) != 0 {
+		t.Errorf("token without session: got %q", b)
+	}
+
+	// A revoked session signs the browser out.
+	if err := repos.Sessions.RevokeAll(context.Background(), "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if tok, cookies := get(valid); tok != "" || len(cookies) != 2 {
+		t.Errorf("revoked session: got %q, cookies %v", tok, cookies)
+	}
+}
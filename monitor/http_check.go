@@ -0,0 +1,143 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/metrics"
+	"github.com/NikoMalik/GoTrack/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Result is the outcome of a single check run.
+type Result struct {
+	AccountID     int64
+	HostServiceID int
+	Host          string
+	Service       string
+	Up            bool
+	StatusCode    int
+	ResponseTime  time.Duration
+	CertExpiry    time.Time
+	Err           error
+	CheckedAt     time.Time
+}
+
+// HTTPCheck requests a URL and considers the service up on a non 5xx answer.
+// For https URLs the expiry of the leaf certificate is recorded as well.
+type HTTPCheck struct {
+	AccountID     int64
+	HostServiceID int
+	Host          string
+	Service       string
+	URL           string
+	Timeout       time.Duration
+	Client        *http.Client
+	// OnResult is called with the result of every run.
+	OnResult func(context.Context, Result)
+}
+
+const defaultCheckTimeout = 10 * time.Second
+
+// Run executes the check and records its result.
+func (h *HTTPCheck) Run(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "check "+h.Service, trace.WithAttributes(
+		attribute.String("gotrack.host", h.Host),
+		attribute.String("gotrack.service", h.Service),
+	))
+	defer span.End()
+
+	res := h.check(ctx)
+	span.SetAttributes(
+		attribute.Bool("gotrack.check.up", res.Up),
+		attribute.Int("http.response.status_code", res.StatusCode),
+	)
+	if res.Err != nil {
+		span.RecordError(res.Err)
+		span.SetStatus(codes.Error, res.Err.Error())
+	}
+	Observe(res)
+	if h.OnResult != nil {
+		h.OnResult(ctx, res)
+	}
+}
+
+func (h *HTTPCheck) check(ctx context.Context) Result {
+	res := Result{
+		AccountID:     h.AccountID,
+		HostServiceID: h.HostServiceID,
+		Host:          h.Host,
+		Service:       h.Service,
+		CheckedAt:     time.Now(),
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	res.ResponseTime = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	res.Up = resp.StatusCode < http.StatusInternalServerError
+	if !res.Up {
+		res.Err = fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	res.CertExpiry = certExpiry(resp.TLS)
+	return res
+}
+
+func certExpiry(state *tls.ConnectionState) time.Time {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return time.Time{}
+	}
+	return state.PeerCertificates[0].NotAfter
+}
+
+var (
+	resultsMu sync.RWMutex
+	results   = make(map[int]Result)
+)
+
+// Observe records the result of a check and exports it as metrics.
+func Observe(res Result) {
+	metrics.ObserveService(res.AccountID, res.HostServiceID, res.Host, res.Service, res.Up, res.ResponseTime, res.CertExpiry)
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	results[res.HostServiceID] = res
+}
+
+// LastResult returns the last recorded result of a host service.
+func LastResult(hostServiceID int) (Result, bool) {
+	resultsMu.RLock()
+	defer resultsMu.RUnlock()
+	res, ok := results[hostServiceID]
+	return res, ok
+}
@@ -0,0 +1,195 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/metrics"
+)
+
+// Check is executed periodically by the scheduler.
+type Check interface {
+	Run(ctx context.Context)
+}
+
+// CheckFunc adapts an ordinary function to a Check.
+type CheckFunc func(ctx context.Context)
+
+// Run calls f(ctx).
+func (f CheckFunc) Run(ctx context.Context) {
+	f(ctx)
+}
+
+// Start starts running the scheduled checks.
+func Start() {
+	sched.start()
+}
+
+// Schedule runs the check every interval under the given id, replacing a
+// check that was scheduled with the same id before.
+func Schedule(id int, interval time.Duration, c Check) {
+	sched.schedule(id, interval, c)
+}
+
+// Unschedule removes the check with the given id.
+// A run that is already in progress is not interrupted.
+func Unschedule(id int) {
+	sched.unschedule(id)
+}
+
+// Running returns true when the scheduler is started and not shut down.
+func Running() bool {
+	return sched.running.Load()
+}
+
+// InFlight returns the number of checks that are currently running.
+func InFlight() int {
+	return int(sched.inflight.Load())
+}
+
+// Shutdown stops scheduling new runs and waits for in-flight checks until
+// ctx is done. Checks still running at that point are cancelled and counted
+// as dropped.
+func Shutdown(ctx context.Context) (int, error) {
+	return sched.shutdown(ctx)
+}
+
+var sched = newScheduler()
+
+type entry struct {
+	interval time.Duration
+	check    Check
+	stopch   chan struct{}
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	entries map[int]*entry
+	started bool
+	closed  bool
+
+	// quitch is closed on shutdown to stop the sync loop.
+	quitch chan struct{}
+
+	running  atomic.Bool
+	inflight atomic.Int64
+	loops    sync.WaitGroup
+
+	// ctx is handed to every check and cancelled when the shutdown deadline passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		entries: make(map[int]*entry),
+		quitch:  make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (s *scheduler) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.closed {
+		return
+	}
+	s.started = true
+	s.running.Store(true)
+
+	for _, e := range s.entries {
+		s.loop(e)
+	}
+}
+
+func (s *scheduler) schedule(id int, interval time.Duration, c Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if old, ok := s.entries[id]; ok {
+		close(old.stopch)
+	}
+
+	e := &entry{
+		interval: interval,
+		check:    c,
+		stopch:   make(chan struct{}),
+	}
+	s.entries[id] = e
+	if s.started {
+		s.loop(e)
+	}
+}
+
+func (s *scheduler) unschedule(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[id]; ok {
+		close(e.stopch)
+		delete(s.entries, id)
+	}
+}
+
+// loop runs the entry on its interval. Runs of the same entry never overlap.
+func (s *scheduler) loop(e *entry) {
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stopch:
+				return
+			case tick := <-ticker.C:
+				metrics.SchedulerLag.Observe(time.Since(tick).Seconds())
+				s.inflight.Add(1)
+				e.check.Run(s.ctx)
+				s.inflight.Add(-1)
+			}
+		}
+	}()
+}
+
+func (s *scheduler) shutdown(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	s.closed = true
+	s.running.Store(false)
+	close(s.quitch)
+	for id, e := range s.entries {
+		close(e.stopch)
+		delete(s.entries, id)
+	}
+	s.mu.Unlock()
+
+	waitch := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		close(waitch)
+	}()
+
+	select {
+	case <-waitch:
+		s.cancel()
+		return 0, nil
+	case <-ctx.Done():
+		dropped := int(s.inflight.Load())
+		s.cancel()
+		return dropped, ctx.Err()
+	}
+}
@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/logEvent"
+	"github.com/NikoMalik/GoTrack/metrics"
+)
+
+// certExpiresSoon is how long before its certificate expires a service is
+// reported as expiring.
+const certExpiresSoon = 14 * 24 * time.Hour
+
+// StartSync schedules a check for every monitored host service and syncs
+// them again every interval, so services that were added, changed or
+// removed since are picked up. Results are recorded on the host service.
+func StartSync(hostServices data.HostServiceRepo, interval time.Duration) {
+	sy := &syncer{hostServices: hostServices, scheduled: make(map[int]data.MonitoredService)}
+	if err := sy.sync(context.Background()); err != nil {
+		logEvent.Error("sync monitored services", "error", err)
+	}
+
+	sched.loops.Add(1)
+	go func() {
+		defer sched.loops.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-sched.quitch:
+				return
+			case <-ticker.C:
+				if err := sy.sync(context.Background()); err != nil {
+					logEvent.Error("sync monitored services", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// syncer keeps the scheduled checks in line with the monitored services.
+type syncer struct {
+	hostServices data.HostServiceRepo
+	// scheduled are the services as they were when their check was scheduled.
+	scheduled map[int]data.MonitoredService
+}
+
+func (sy *syncer) sync(ctx context.Context) error {
+	services, err := sy.hostServices.ListMonitored(ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool, len(services))
+	for _, s := range services {
+		seen[s.HostServiceID] = true
+		old, ok := sy.scheduled[s.HostServiceID]
+		if ok && old == s {
+			continue
+		}
+		// The series of the old host and service name would be kept.
+		if ok && (old.HostName != s.HostName || old.ServiceName != s.ServiceName) {
+			metrics.ForgetService(s.HostServiceID)
+		}
+		Schedule(s.HostServiceID, s.Interval(), &HTTPCheck{
+			AccountID:     s.AccountID,
+			HostServiceID: s.HostServiceID,
+			Host:          s.HostName,
+			Service:       s.ServiceName,
+			URL:           s.URL,
+			OnResult:      sy.record(s),
+		})
+		sy.scheduled[s.HostServiceID] = s
+	}
+
+	for id := range sy.scheduled {
+		if !seen[id] {
+			Unschedule(id)
+			metrics.ForgetService(id)
+			delete(sy.scheduled, id)
+		}
+	}
+	return nil
+}
+
+// record returns the OnResult of the check of s, which stores the result.
+func (sy *syncer) record(s data.MonitoredService) func(context.Context, Result) {
+	return func(ctx context.Context, res Result) {
+		status, message := checkStatus(res)
+		err := sy.hostServices.RecordCheck(ctx, s, status, message, res.CheckedAt)
+		// A service removed since the last sync has nothing to record on.
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logEvent.Error("record check", "host_service_id", s.HostServiceID, "error", err)
+		}
+	}
+}
+
+// checkStatus returns the status of a host service and the message
+// explaining it for the result of a check.
+func checkStatus(res Result) (string, string) {
+	switch {
+	case res.Err != nil && res.StatusCode == 0:
+		return data.StatusOffline, res.Err.Error()
+	case !res.Up:
+		return data.StatusUnresponsive, res.Err.Error()
+	}
+
+	message := fmt.Sprintf("status %d in %s", res.StatusCode, res.ResponseTime.Round(time.Millisecond))
+	switch {
+	case res.CertExpiry.IsZero():
+		return data.StatusHealthy, message
+	case res.CheckedAt.After(res.CertExpiry):
+		return data.StatusExpired, "certificate expired " + res.CertExpiry.UTC().Format(time.DateOnly)
+	case res.CertExpiry.Sub(res.CheckedAt) < certExpiresSoon:
+		return data.StatusExpires, "certificate expires " + res.CertExpiry.UTC().Format(time.DateOnly)
+	}
+	return data.StatusHealthy, message
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/data"
+	"github.com/NikoMalik/GoTrack/data/memory"
+)
+
+func TestSync(t *testing.T) {
+	store := memory.NewStore()
+	store.Hosts[1] = &data.Host{ID: 1, HostName: "example.com", Active: 1}
+	store.Services[1] = &data.Services{ID: 1, ServiceName: "https"}
+	store.HostServices[1] = &data.HostService{ID: 1, HostID: 1, ServiceID: 1, Active: 1, ScheduleNumber: 1, ScheduleUnit: "m", Status: "pending"}
+	sy := &syncer{hostServices: memory.NewRepos(store).HostServices, scheduled: make(map[int]data.MonitoredService)}
+	scheduled := func(id int) bool {
+		sched.mu.Lock()
+		defer sched.mu.Unlock()
+		_, ok := sched.entries[id]
+		return ok
+	}
+	ctx := context.Background()
+
+	if err := sy.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !scheduled(1) {
+		t.Fatal("service not scheduled")
+	}
+
+	record := sy.record(sy.scheduled[1])
+	now := time.Now()
+	record(ctx, Result{Up: true, StatusCode: 200, CheckedAt: now})
+	record(ctx, Result{Up: true, StatusCode: 200, CheckedAt: now})
+	record(ctx, Result{Err: errors.New("connection refused"), CheckedAt: now})
+	if hs := store.HostServices[1]; hs.Status != data.StatusOffline || !hs.LastCheck.Equal(now) || hs.LastMessage != "connection refused" {
+		t.Errorf("host service after checks: %+v", hs)
+	}
+	if len(store.Events) != 2 || store.Events[0].EventType != data.StatusHealthy || store.Events[1].EventType != data.StatusOffline {
+		t.Errorf("events %+v, want one per status change", store.Events)
+	}
+
+	store.HostServices[1].Active = 0
+	if err := sy.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if scheduled(1) {
+		t.Error("deactivated service still scheduled")
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		res    Result
+		status string
+	}{
+		{Result{Up: true, StatusCode: 200, CheckedAt: now}, data.StatusHealthy},
+		{Result{Up: true, StatusCode: 200, CheckedAt: now, CertExpiry: now.Add(90 * 24 * time.Hour)}, data.StatusHealthy},
+		{Result{Up: true, StatusCode: 200, CheckedAt: now, CertExpiry: now.Add(24 * time.Hour)}, data.StatusExpires},
+		{Result{Up: true, StatusCode: 200, CheckedAt: now, CertExpiry: now.Add(-time.Hour)}, data.StatusExpired},
+		{Result{StatusCode: 503, Err: errors.New("unexpected status 503"), CheckedAt: now}, data.StatusUnresponsive},
+		{Result{Err: errors.New("no such host"), CheckedAt: now}, data.StatusOffline},
+	}
+	for _, tt := range tests {
+		if status, _ := checkStatus(tt.res); status != tt.status {
+			t.Errorf("checkStatus(%+v) = %q, want %q", tt.res, status, tt.status)
+		}
+	}
+}
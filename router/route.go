@@ -3,7 +3,9 @@ package router
 import (
 	"log"
 
+	"github.com/NikoMalik/GoTrack/data"
 	"github.com/NikoMalik/GoTrack/handlers"
+	"github.com/NikoMalik/GoTrack/middleware"
 	"github.com/NikoMalik/GoTrack/routes/authRouter"
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
@@ -15,6 +17,53 @@ func Setup(app *fiber.App) {
 	app.Get("/", handlers.HandleGetHome)
 	app.Get("/pricing", handlers.HandlePricing)
 
+	// Everything below needs a signed in user.
+	account := app.Group("/account", middleware.RequireAuth)
+
+	auditRead := handlers.RequirePermission(data.PermAuditRead)
+	account.Get("/audit", auditRead, handlers.HandleGetAudit)
+	account.Get("/audit/export", auditRead, handlers.HandleGetAuditExport)
+
+	membersRead := handlers.RequirePermission(data.PermMembersRead)
+	membersWrite := handlers.RequirePermission(data.PermMembersWrite)
+	account.Get("/members", membersRead, handlers.HandleGetMembers)
+	account.Post("/members/invite", membersWrite, handlers.HandlePostInvite)
+	account.Post("/members/:userID/role", membersWrite, handlers.HandlePostSetRole)
+	account.Post("/members/:userID/remove", handlers.HandlePostRemoveMember)
+	account.Post("/invitations/:id/accept", handlers.HandlePostAcceptInvitation)
+	account.Post("/invitations/:id/revoke", membersWrite, handlers.HandlePostRevokeInvitation)
+	account.Post("/switch", handlers.HandlePostSwitchAccount)
+
+	account.Get("/sessions", handlers.HandleGetSessions)
+	account.Post("/sessions/revoke", handlers.HandlePostRevokeAllSessions)
+	account.Post("/sessions/:id/revoke", handlers.HandlePostRevokeSession)
+	account.Get("/password", handlers.HandleGetChangePassword)
+	account.Post("/password", handlers.HandlePostChangePassword)
+	account.Get("/2fa", handlers.HandleGetTwoFactor)
+	account.Post("/2fa/enable", handlers.HandlePostEnableTwoFactor)
+	account.Post("/2fa/disable", handlers.HandlePostDisableTwoFactor)
+	account.Post("/2fa/require", handlers.RequirePermission(data.PermAccountWrite), handlers.HandlePostRequireTwoFactor)
+
+	// Keys only reach the hosts API, so they are of no use without it.
+	hostsRead := handlers.RequirePermission(data.PermHostsRead)
+	account.Get("/keys", hostsRead, handlers.HandleGetAPIKeys)
+	account.Post("/keys", hostsRead, handlers.HandlePostCreateAPIKey)
+	account.Post("/keys/:id/revoke", handlers.HandlePostRevokeAPIKey)
+
+	app.Get("/hosts", middleware.RequireAuth, hostsRead, handlers.HandleGetHosts)
+	app.Get("/services", middleware.RequireAuth, hostsRead, handlers.HandleGetServices)
+	app.Get("/events", middleware.RequireAuth, hostsRead, handlers.HandleGetEvents)
+
+	api := app.Group("/api", middleware.RequireAuth)
+	api.Get("/hosts", hostsRead, handlers.HandleAPIGetHosts)
+	api.Get("/services", hostsRead, handlers.HandleAPIGetServices)
+	api.Get("/events", hostsRead, handlers.HandleAPIGetEvents)
+
+	hostsWrite := handlers.RequirePermission(data.PermHostsWrite)
+	api.Post("/hosts", hostsWrite, handlers.HandleAPIPostHost)
+	api.Put("/hosts/:id", hostsWrite, handlers.HandleAPIPutHost)
+	api.Delete("/hosts/:id", hostsWrite, handlers.HandleAPIDeleteHost)
+
 	//auth routes
 
 	authRouter.SetupAuthRoutes(app)
@@ -38,6 +87,16 @@ func Setup(app *fiber.App) {
 	})
 }
 
+// SetupProbes registers the health, readiness and version endpoints.
+// It has to be called before the rate limiter and auth middleware are
+// added, so load balancers and orchestrators are never throttled or
+// redirected.
+func SetupProbes(app *fiber.App) {
+	app.Get("/healthz", handlers.HandleHealthz)
+	app.Get("/readyz", handlers.HandleReadyz)
+	app.Get("/version", handlers.HandleVersion)
+}
+
 func setupWebSocketRoutes(app *fiber.App) {
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
@@ -13,11 +13,17 @@ func SetupAuthRoutes(router fiber.Router) {
 	auth.Get("/login", handlers.HandleGetLogin)
 	auth.Post("/login", handlers.HandleLoginWithEmail)
 	auth.Post("/resend-email-verification", handlers.HandleResendVerificationCode)
-	// auth.Post("/signup/google", handlers.HandleSignInWithGoogle)
+	auth.Get("/verify", handlers.HandleVerifyEmail)
+	auth.Get("/forgot", handlers.HandleGetForgotPassword)
+	auth.Post("/forgot", handlers.HandlePostForgotPassword)
+	auth.Get("/reset", handlers.HandleGetResetPassword)
+	auth.Post("/reset", handlers.HandlePostResetPassword)
+	auth.Get("/2fa", handlers.HandleGetTwoFactorChallenge)
+	auth.Post("/2fa", handlers.HandlePostTwoFactorChallenge)
+	auth.Post("/signup/google", handlers.HandleSignInWithGoogle)
 	auth.Post("/signup/github", handlers.HandleSignInWithGithub)
-	auth.Get("/callback/", handlers.HandleAuthCallback)
-	auth.Post("/callback", handlers.HandleAuthCallback)
+	auth.Get("/callback", handlers.HandleAuthCallback)
 	auth.Get("/signout", handlers.HandleGetSignOut) // just leave with token
-	auth.Get("/signin", handlers.HandleGetSignIn)   //get page
+	auth.Get("/signin", handlers.HandleGetLogin)    //get page
 
 }
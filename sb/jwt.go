@@ -0,0 +1,258 @@
+package sb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNoKey is returned when there is no key to verify a token with, either
+// because none is configured or because the JWKS can't be fetched.
+var ErrNoKey = errors.New("sb: no key to verify the token")
+
+// jwksMinRefetch limits how often an unknown key id triggers a refetch of
+// the JWKS, so tokens with made up key ids can't hammer Supabase.
+const jwksMinRefetch = time.Minute
+
+// Claims are the claims of a Supabase access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email        string         `json:"email"`
+	Role         string         `json:"role"`
+	UserMetadata map[string]any `json:"user_metadata"`
+}
+
+// Verifier verifies Supabase access tokens without calling Supabase: HS256
+// tokens with the project secret, RS256 and ES256 tokens with the keys of
+// a JWKS.
+type Verifier struct {
+	secret []byte
+	jwks   *JWKS
+	parser *jwt.Parser
+}
+
+// NewVerifier returns a verifier for the tokens of the project of cfg.
+// The JWKS is fetched with client.
+func NewVerifier(cfg config.Supabase, client *http.Client) *Verifier {
+	jwksURL, issuer := cfg.JWKSURL, cfg.Issuer
+	if jwksURL == "" {
+		jwksURL = cfg.AuthURL() + "/.well-known/jwks.json"
+	}
+	if issuer == "" {
+		issuer = cfg.AuthURL()
+	}
+	return &Verifier{
+		secret: []byte(cfg.JWTSecret),
+		jwks:   NewJWKS(jwksURL, cfg.JWKSRefresh, client),
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithIssuer(issuer),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(30*time.Second),
+		),
+	}
+}
+
+// Verify checks the signature, expiry, audience and issuer of token and
+// returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		if t.Method.Alg() == "HS256" {
+			if len(v.secret) == 0 {
+				return nil, ErrNoKey
+			}
+			return v.secret, nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.jwks.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JWKS is a cached JSON Web Key Set. The keys are refetched once they are
+// older than the refresh interval, or when a token names an unknown key.
+// Stale keys keep being served while they are refetched in the background.
+type JWKS struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	group   singleflight.Group
+
+	// mu guards the fields below. It's never held during a fetch.
+	mu        sync.Mutex
+	keys      map[string]any
+	fetched   time.Time
+	attempted time.Time
+}
+
+// jwksFetchTimeout bounds a fetch of the JWKS, which isn't tied to the
+// request that triggered it.
+const jwksFetchTimeout = 10 * time.Second
+
+// NewJWKS returns the key set published at url.
+func NewJWKS(url string, refresh time.Duration, client *http.Client) *JWKS {
+	return &JWKS{url: url, refresh: refresh, client: client}
+}
+
+// Key returns the public key with the id kid.
+func (k *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	k.mu.Lock()
+	keys, stale := k.keys, time.Since(k.fetched) > k.refresh
+	key, known := keys[kid]
+	retry := time.Since(k.attempted) > jwksMinRefetch
+	k.mu.Unlock()
+
+	switch {
+	case known:
+		if stale && retry {
+			k.group.DoChan("fetch", k.update)
+		}
+		return key, nil
+	case keys != nil && !retry:
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrNoKey, kid)
+	}
+
+	// No keys yet, or a key we don't know about: wait for the fetch.
+	select {
+	case res := <-k.group.DoChan("fetch", k.update):
+		k.mu.Lock()
+		keys = k.keys
+		k.mu.Unlock()
+		if keys == nil {
+			return nil, fmt.Errorf("%w: %v", ErrNoKey, res.Err)
+		}
+		// On error keep using the keys we have until Supabase is back.
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrNoKey, kid)
+}
+
+// update fetches the keys and swaps them in. It runs in the group, so
+// there is one fetch at a time.
+func (k *JWKS) update() (any, error) {
+	k.mu.Lock()
+	k.attempted = time.Now()
+	k.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	keys, err := k.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	k.keys, k.fetched = keys, time.Now()
+	k.mu.Unlock()
+	return nil, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *JWKS) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks returned %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		key, err := j.publicKey()
+		if err != nil {
+			// Skip keys we can't use instead of failing the whole set.
+			continue
+		}
+		keys[j.Kid] = key
+	}
+	return keys, nil
+}
+
+func (j jwk) publicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decodeInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,133 @@
+package sb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+	// The JWKS stand-in publishes the EC key only after the first fetch,
+	// like a rotation.
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		}
+		if fetches.Add(1) > 1 {
+			keys = append(keys, map[string]string{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	cfg := config.Supabase{
+		URL:         "https://project.supabase.co",
+		JWTSecret:   "secret",
+		JWKSURL:     srv.URL,
+		JWKSRefresh: time.Hour,
+		Audience:    "authenticated",
+	}
+	v := NewVerifier(cfg, srv.Client())
+
+	claims := func(mod func(*Claims)) *Claims {
+		c := &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "u1",
+				Issuer:    cfg.AuthURL(),
+				Audience:  jwt.ClaimStrings{"authenticated"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			Email:        "a@example.com",
+			UserMetadata: map[string]any{"Name": "Ann"},
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, c *Claims) string {
+		tok := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	valid := []string{
+		sign(jwt.SigningMethodHS256, "", []byte("secret"), claims(nil)),
+		sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)),
+	}
+	for _, tok := range valid {
+		c, err := v.Verify(context.Background(), tok)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if c.Subject != "u1" || c.Email != "a@example.com" || c.UserMetadata["Name"] != "Ann" {
+			t.Errorf("claims = %+v", c)
+		}
+	}
+
+	// An unknown key id refetches the JWKS, at most once a minute.
+	v.jwks.attempted = time.Now().Add(-2 * jwksMinRefetch)
+	if _, err := v.Verify(context.Background(), sign(jwt.SigningMethodES256, "ec", ecKey, claims(nil))); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(jwt.SigningMethodES256, "other", ecKey, claims(nil))); !errors.Is(err, ErrNoKey) {
+		t.Errorf("unknown key id: err = %v, want ErrNoKey", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("jwks fetched %d times, want 2", n)
+	}
+
+	// Stale keys are served while they are refetched in the background.
+	v.jwks.mu.Lock()
+	v.jwks.fetched = time.Now().Add(-2 * cfg.JWKSRefresh)
+	v.jwks.attempted = time.Now().Add(-2 * jwksMinRefetch)
+	v.jwks.mu.Unlock()
+	if _, err := v.Verify(context.Background(), valid[1]); err != nil {
+		t.Errorf("stale key: %v", err)
+	}
+	for i := 0; fetches.Load() != 3 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := fetches.Load(); n != 3 {
+		t.Errorf("jwks fetched %d times, want a background refresh", n)
+	}
+
+	invalid := map[string]string{
+		"expired":      sign(jwt.SigningMethodHS256, "", []byte("secret"), claims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour)) })),
+		"no expiry":    sign(jwt.SigningMethodHS256, "", []byte("secret"), claims(func(c *Claims) { c.ExpiresAt = nil })),
+		"audience":     sign(jwt.SigningMethodHS256, "", []byte("secret"), claims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"anon"} })),
+		"issuer":       sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c *Claims) { c.Issuer = "https://evil.example.com" })),
+		"wrong secret": sign(jwt.SigningMethodHS256, "", []byte("guess"), claims(nil)),
+		"wrong key":    sign(jwt.SigningMethodES256, "rsa", ecKey, claims(nil)),
+	}
+	for name, tok := range invalid {
+		if _, err := v.Verify(context.Background(), tok); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
@@ -1,28 +1,147 @@
 package sb
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/NikoMalik/GoTrack/config"
+	"github.com/NikoMalik/GoTrack/tracing"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/nedpals/supabase-go"
 )
 
 var Client *supabase.Client
 
-// Init initializes the supabase client using the SUPABASE_URL and SUPABASE_KEY environment variables.
-// It returns an error if either of the environment variables is not set.
-func Init() error {
-	sbHost := os.Getenv("SUPABASE_URL")
-	sbKey := os.Getenv("SUPABASE_KEY")
+var (
+	supabaseCfg config.Supabase
+	verifier    *Verifier
+)
+
+// Init initializes the supabase client using the configured url and key.
+// It returns an error if either of them is not set.
+func Init(cfg config.Supabase) error {
+	sbHost := cfg.URL
+	sbKey := cfg.Key
 
 	if sbHost == "" {
-		return fmt.Errorf("SUPABASE_URL environment variable is not set")
+		return fmt.Errorf("SUPABASE_URL is not set")
 	}
 
 	if sbKey == "" {
-		return fmt.Errorf("SUPABASE_KEY environment variable is not set")
+		return fmt.Errorf("SUPABASE_KEY is not set")
 	}
 
 	Client = supabase.CreateClient(sbHost, sbKey)
+	Client.HTTPClient.Transport = &tracing.Transport{Name: "supabase"}
+	supabaseCfg = cfg
+	verifier = NewVerifier(cfg, Client.HTTPClient)
+	return nil
+}
+
+// VerifyToken returns the claims of a valid access token. Tokens are
+// verified locally, Supabase is only asked when there is no key to verify
+// one with and the remote fallback is enabled.
+func VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	claims, err := verifier.Verify(ctx, token)
+	if !errors.Is(err, ErrNoKey) || !supabaseCfg.RemoteFallback {
+		return claims, err
+	}
+	user, err := Client.Auth.User(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: user.ID},
+		Email:            user.Email,
+		Role:             user.Role,
+		UserMetadata:     user.UserMetadata,
+	}, nil
+}
+
+// Ping checks that the Supabase auth service is reachable.
+func Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(supabaseCfg.URL, "/")+"/auth/v1/health", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apikey", supabaseCfg.Key)
+
+	resp, err := Client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("supabase health returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SetPassword sets the password of a user with the service role key, for
+// resets where the user can't sign in. Unlike Client.Admin.UpdateUser it
+// sends no other fields, which would be cleared.
+func SetPassword(ctx context.Context, userID, password string) error {
+	body, err := json.Marshal(map[string]string{"password": password})
+	if err != nil {
+		return err
+	}
+	return authRequest(ctx, http.MethodPut, "/admin/users/"+userID, supabaseCfg.ServiceRoleKey, body, "set password")
+}
+
+// Scopes of Logout.
+const (
+	// LogoutLocal revokes the session of the access token.
+	LogoutLocal = "local"
+	// LogoutOthers revokes every other session of the user.
+	LogoutOthers = "others"
+	// LogoutGlobal revokes every session of the user.
+	LogoutGlobal = "global"
+)
+
+// Logout revokes the refresh tokens of the user of accessToken in scope,
+// like the admin sign out of the Supabase clients. The access tokens stay
+// valid until they expire.
+func Logout(ctx context.Context, accessToken, scope string) error {
+	return authRequest(ctx, http.MethodPost, "/logout?scope="+url.QueryEscape(scope), accessToken, nil, "logout")
+}
+
+// LogoutEverywhere revokes the refresh tokens of every session of the user
+// with email and password. The auth API can only sign out the user of an
+// access token, so it signs in first.
+func LogoutEverywhere(ctx context.Context, email, password string) error {
+	details, err := Client.Auth.SignIn(ctx, supabase.UserCredentials{Email: email, Password: password})
+	if err != nil {
+		return err
+	}
+	return Logout(ctx, details.AccessToken, LogoutGlobal)
+}
+
+// authRequest sends body to path of the auth API with the service role key
+// as api key and token as bearer token.
+func authRequest(ctx context.Context, method, path, token string, body []byte, op string) error {
+	req, err := http.NewRequestWithContext(ctx, method, supabaseCfg.AuthURL()+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", supabaseCfg.ServiceRoleKey)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := Client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("supabase %s returned %s", op, resp.Status)
+	}
 	return nil
 }
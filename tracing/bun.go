@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatementLen bounds the query text attached to a span.
+const maxStatementLen = 2048
+
+// QueryHook is a bun.QueryHook recording a span for every query,
+// registered like the bundebug hook:
+//
+//	db.Bun.AddQueryHook(tracing.QueryHook{})
+type QueryHook struct{}
+
+var _ bun.QueryHook = QueryHook{}
+
+// BeforeQuery implements bun.QueryHook.
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db "+event.Operation(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			attribute.String("db.operation.name", event.Operation()),
+		),
+	)
+	return ctx
+}
+
+// AfterQuery implements bun.QueryHook.
+func (QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	query := queryTemplate(event)
+	if len(query) > maxStatementLen {
+		query = query[:maxStatementLen]
+	}
+	span.SetAttributes(attribute.String("db.query.text", query))
+
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+}
+
+// queryTemplate returns the query of event with placeholders in place of
+// the arguments, so values like tokens and emails stay out of the traces.
+func queryTemplate(event *bun.QueryEvent) string {
+	if event.IQuery != nil {
+		if b, err := event.IQuery.AppendQuery(schema.NewNopFormatter(), nil); err == nil {
+			return string(b)
+		}
+	}
+	return event.QueryTemplate
+}
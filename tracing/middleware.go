@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for every request, continuing a trace
+// propagated by the caller. The span context is stored as the user context
+// of the request, so handlers pass c.UserContext() to downstream calls.
+func Middleware(c *fiber.Ctx) error {
+	carrier := propagation.HeaderCarrier{}
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		carrier.Set(string(k), string(v))
+	})
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+	ctx, span := Tracer().Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.ClientAddress(c.IP()),
+			semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+	err := c.Next()
+
+	// The route is only known once the router matched the request.
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+
+	status := c.Response().StatusCode()
+	if e, ok := err.(*fiber.Error); ok {
+		status = e.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	return err
+}
+
+// Transport is an http.RoundTripper that records a client span per request
+// and propagates the trace to the remote service.
+type Transport struct {
+	Base http.RoundTripper
+	// Name prefixes the span names, e.g. "supabase".
+	Name string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := Tracer().Start(req.Context(), t.Name+" "+req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// initTesting installs a tracer provider that keeps every span in memory
+// and returns the exporter to inspect them.
+func initTesting() *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	return exp
+}
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	exp := initTesting()
+
+	var gotParent string
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotParent = r.Header.Get("traceparent")
+	}))
+	defer remote.Close()
+
+	client := &http.Client{Transport: &Transport{Name: "remote"}}
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Get("/hosts/:id", func(c *fiber.Ctx) error {
+		req, err := http.NewRequestWithContext(c.UserContext(), http.MethodGet, remote.URL+"/ping", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/hosts/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	remoteSpan, server := spans[0], spans[1]
+	if server.Name != "GET /hosts/:id" {
+		t.Errorf("expected server span named after the route, got %q", server.Name)
+	}
+	if server.SpanContext.TraceID().String() != traceID {
+		t.Errorf("expected the incoming trace to be continued, got %s", server.SpanContext.TraceID())
+	}
+	if remoteSpan.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("expected the client span to be a child of the server span")
+	}
+	if gotParent == "" {
+		t.Error("expected the trace to be propagated to the remote service")
+	}
+}
+
+func TestQueryTemplate(t *testing.T) {
+	db := bun.NewDB(nil, pgdialect.New())
+	q := db.NewSelect().Table("users").Where("email = ?", "a@example.com")
+	event := &bun.QueryEvent{IQuery: q, Query: q.String()}
+	if got := queryTemplate(event); strings.Contains(got, "a@example.com") || !strings.Contains(got, "email = ?") {
+		t.Errorf("queryTemplate = %q", got)
+	}
+}